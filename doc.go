@@ -6,6 +6,53 @@
 // Use [MysqlClient] to manage GORM-backed MySQL access. Initialize a client with [NewMysqlClient]
 // or [NewMysqlClientWithLog], then obtain a request-scoped session with [MysqlClient.DB] or
 // [MysqlClient.Tx]. Use [DebugMode] or [ReleaseMode] to control SQL logging verbosity.
+// [NewMysqlClientWithOptions] accepts [MysqlOption] values for pool limits, logging, naming strategy,
+// extra GORM plugins, prepared statements, the startup ping timeout, and the client's metric label.
+// [WithStatementTimeout] bounds statements whose context has no deadline, and with [WithExecutionTimeHints] SELECTs
+// carry a MAX_EXECUTION_TIME hint derived from their remaining deadline. [WithCircuitBreaker] fails
+// statements fast with [ErrCircuitOpen] while the database is failing or overloaded. [MysqlConfig] builds the DSN
+// from structured settings, loaded with [LoadMysqlConfigFromYAML] or [LoadMysqlConfigFromEnv], and
+// [NewMysqlClientFromConfig] opens a client from it. [WithQueryStats] aggregates latency, rows, and errors per SQL
+// fingerprint in process, served as JSON by the [QueryStats] handler. A [QueryRecorder] attached with
+// [WithQueryRecorder] counts the statements of a request or test and reports fingerprints repeated beyond its
+// threshold as an [NPlusOneError].
+//
+// [NewMysqlClientWithReplicas] and [WithReplicas] add read/write splitting: plain reads are spread across
+// replicas by a [ReplicaPolicy], while writes, locking reads, transactions, and contexts marked with
+// [WithPrimary] stay on the primary.
+//
+// [MysqlClient.WithTx] runs a closure inside a managed transaction that commits on success, rolls back on
+// error or panic, and accepts [TxOption] values such as [WithIsolationLevel] and [WithReadOnly]. The active
+// transaction travels in the context: [MysqlClient.DB] joins it, and nested [MysqlClient.WithTx] or
+// [MysqlClient.WithTxContext] calls run inside SAVEPOINTs.
+// Pass [WithRetry] with a [TxRetryPolicy] to re-execute the whole transaction on deadlocks and lock-wait
+// timeouts; see [IsTransientMysqlError] and [TransientMysqlError].
+//
+// Slow statements are logged with their calling code location and counted in [MysqlSlowQueryCounter]. Tune
+// detection per client with [MysqlClient.SetSlowThreshold], [MysqlClient.SetSlowLogLevel],
+// [MysqlClient.SetSlowLogBudget], and [MysqlClient.SetParameterizedQueries]. [MysqlClient.SetSlowExplainBudget]
+// attaches a rate-limited EXPLAIN FORMAT=JSON plan to slow SELECT entries.
+//
+// Every client exports its connection-pool statistics from a background goroutine. [MysqlClient.Close] drains
+// in-flight statements until its context is done, stops the reporter, and releases the connections; later
+// sessions fail fast with [ErrClientClosed].
+//
+// [Repo] provides typed Get, FindWhere, Create, UpdateFields, Delete, Count, and Exists helpers for a model
+// and reports missing rows as [ErrNotFound]. [Paginate] implements keyset pagination over the columns of a [Paginator]
+// and returns signed, opaque cursor tokens for forward and backward paging, bound to the table and a caller scope;
+// [Paginator.AcrossMonthlyShards] pages monthly-sharded tables shard by shard. [MysqlClient.BulkUpsert] writes large
+// row sets with INSERT ... ON DUPLICATE KEY UPDATE in size-bounded chunks and reports a [BulkUpsertResult].
+//
+// Models with a [Version] field get optimistic locking: updates of a loaded model check and increment the version
+// and fail with [ErrStaleVersion] on a concurrent change. [Repo.Modify] reloads and retries such updates.
+// [MysqlRouter] serves several tenants, each with its own [MysqlClient], and picks the client from the tenant in the
+// context; see [WithTenant] and [TenantResolver]. [WithAudit] stamps audit columns with the actor of [WithActor] and
+// UTC times, and can record a row-level audit trail in the transaction of each change. [WithQueryCache] caches the
+// results of queries marked with [WithCachedReads] or [Cached] in Redis and invalidates them when their tables are
+// written.
+// [MysqlClient.Lock] acquires a named advisory lock for singleton jobs and signals its loss through [MysqlLock.Lost].
+// [Migrator] applies versioned SQL or Go migrations loaded from an [io/fs.FS], with checksums, dry runs, and target
+// versions.
 //
 // # Redis
 //
@@ -18,15 +65,20 @@
 // [KafkaAsyncSender] and [KafkaSyncSender] publish JSON-encoded payloads to fixed topics.
 // [KafkaReceiver] joins a consumer group, waits for the initial session to be established, and
 // delivers payloads through [ReceiverHandler]. Message handlers receive the consumer-session context
-// so they can react promptly to shutdown and rebalance signals.
+// so they can react promptly to shutdown and rebalance signals. [Outbox.Add] stores a message in the transaction of
+// the write that produces it, and an [OutboxRelay] publishes stored messages through [KafkaSyncSender] values.
 //
 // # Sharding
 //
 // [MonthlyShardingByOid] and [MonthlyShardingByTime] register UTC-based monthly sharding rules with
-// gorm.io/sharding, ensuring deterministic routing across deployment time zones.
+// gorm.io/sharding, ensuring deterministic routing across deployment time zones. [MonthlyShardTableByOid] and
+// [MonthlyShardTableByTime] name the physical shard for queries the sharding middleware cannot route.
 //
 // # Metrics
 //
-// SQL latency and Redis pool metrics are registered on [MysqlHistogram], [RedisPoolOpGauge], and
-// [RedisConnStatusGauge]. Refer to each variable for metric names and label dimensions.
+// SQL, transaction, and pool metrics are registered on [MysqlHistogram], [MysqlSlowQueryCounter],
+// [MysqlTxHistogram], [MysqlTxRetryCounter], [MysqlConnStatusGauge], [MysqlPoolOpGauge], [MysqlCircuitStateGauge],
+// [MysqlQueryCacheCounter], [MysqlNPlusOneCounter], [MysqlOutboxBacklogGauge], [MysqlOutboxLagGauge],
+// [MysqlOutboxCounter], [RedisPoolOpGauge], and [RedisConnStatusGauge]. Refer to each variable for metric names and
+// label dimensions.
 package tdb
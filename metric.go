@@ -5,11 +5,102 @@ import (
 )
 
 var (
-	// MysqlHistogram records SQL statement latency in milliseconds, labeled by table name, primary clause, and execution outcome.
+	// MysqlHistogram records SQL statement latency in milliseconds, labeled by table name, primary clause, execution outcome
+	// (SUCCESS, FAILED, TIMEOUT, or REJECTED by the circuit breaker), and the node (primary or replica) that served the
+	// statement. Raw SQL is labeled by parsing the statement.
 	MysqlHistogram, _ = tmetric.NewHistogramVec(
 		"mysql_latency",
-		"SQL statement latency in milliseconds, labeled by table, primary clause, and outcome.",
-		[]string{"sql_table", "sql_operation", "sql_status"},
+		"SQL statement latency in milliseconds, labeled by table, primary clause, outcome, and serving node.",
+		[]string{"sql_table", "sql_operation", "sql_status", "sql_node"},
+	)
+
+	// MysqlSlowQueryCounter counts statements slower than the client's slow-query threshold, labeled by table name and primary clause.
+	MysqlSlowQueryCounter, _ = tmetric.NewCounterVec(
+		"mysql_slow_queries_total",
+		"SQL statements exceeding the slow-query threshold, labeled by table and primary clause.",
+		[]string{"sql_table", "sql_operation"},
+	)
+
+	// MysqlTxHistogram records the duration of transactions run by [MysqlClient.WithTx] in milliseconds, labeled by outcome.
+	MysqlTxHistogram, _ = tmetric.NewHistogramVec(
+		"mysql_tx_latency",
+		"Managed transaction duration in milliseconds, labeled by outcome.",
+		[]string{"tx_status"},
+	)
+
+	// MysqlTxRetryCounter counts transactions re-executed by a [TxRetryPolicy], labeled by the transient error kind.
+	MysqlTxRetryCounter, _ = tmetric.NewCounterVec(
+		"mysql_tx_retries_total",
+		"Managed transaction retries caused by transient MySQL errors, labeled by error kind (deadlock, lock_wait_timeout).",
+		[]string{"mysql_error"},
+	)
+)
+
+var (
+	// MysqlConnStatusGauge reports the number of open, in-use, and idle MySQL connections per client and node.
+	MysqlConnStatusGauge, _ = tmetric.NewGaugeVec(
+		"mysql_conn_status",
+		"MySQL connection counts by state (open, in use, idle), labeled by client and serving node.",
+		[]string{"mysql_db", "sql_node", "mysql_conn_status"},
+	)
+
+	// MysqlPoolOpGauge reports cumulative MySQL connection-pool counters, including waits and connections closed by idle or lifetime limits.
+	MysqlPoolOpGauge, _ = tmetric.NewGaugeVec(
+		"mysql_pool_op",
+		"MySQL connection pool counters (wait count, wait duration in milliseconds, connections closed by max idle, max idle time, and max lifetime).",
+		[]string{"mysql_db", "sql_node", "mysql_pool_op"},
+	)
+
+	// MysqlCircuitStateGauge reports the state of the circuit breaker installed by [WithCircuitBreaker]: 1 for the
+	// current state (closed, open, or half_open) of each client and 0 for the others.
+	MysqlCircuitStateGauge, _ = tmetric.NewGaugeVec(
+		"mysql_circuit_state",
+		"MySQL circuit breaker state (closed, open, half_open), 1 for the current state, labeled by client.",
+		[]string{"mysql_db", "circuit_state"},
+	)
+)
+
+var (
+	// MysqlQueryCacheCounter counts lookups of the query cache installed by [WithQueryCache], labeled by table and
+	// result (hit, miss, or error when Redis could not be read).
+	MysqlQueryCacheCounter, _ = tmetric.NewCounterVec(
+		"mysql_query_cache_total",
+		"Query cache lookups (hit, miss, error), labeled by table.",
+		[]string{"sql_table", "cache_result"},
+	)
+)
+
+var (
+	// MysqlNPlusOneCounter counts statement fingerprints that a [QueryRecorder] saw repeated beyond its threshold,
+	// once per recorder and fingerprint, labeled by table name.
+	MysqlNPlusOneCounter, _ = tmetric.NewCounterVec(
+		"mysql_n_plus_one_total",
+		"Statement fingerprints repeated beyond the n+1 threshold within one recorder, labeled by table.",
+		[]string{"sql_table"},
+	)
+)
+
+var (
+	// MysqlOutboxBacklogGauge reports the number of messages of an [Outbox] table waiting to be published.
+	MysqlOutboxBacklogGauge, _ = tmetric.NewGaugeVec(
+		"mysql_outbox_backlog",
+		"Outbox messages waiting to be published, labeled by outbox table.",
+		[]string{"outbox_table"},
+	)
+
+	// MysqlOutboxLagGauge reports the age in milliseconds of the oldest message of an [Outbox] table waiting to be published.
+	MysqlOutboxLagGauge, _ = tmetric.NewGaugeVec(
+		"mysql_outbox_lag",
+		"Age in milliseconds of the oldest outbox message waiting to be published, labeled by outbox table.",
+		[]string{"outbox_table"},
+	)
+
+	// MysqlOutboxCounter counts publish outcomes of an [OutboxRelay]: sent, retry (a failed attempt that will be
+	// retried), or failed (given up after the maximum number of attempts).
+	MysqlOutboxCounter, _ = tmetric.NewCounterVec(
+		"mysql_outbox_messages_total",
+		"Outbox publish outcomes (sent, retry, failed), labeled by outbox table.",
+		[]string{"outbox_table", "outbox_status"},
 	)
 )
 
@@ -2,6 +2,10 @@ package tdb
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
@@ -13,9 +17,12 @@ import (
 	"github.com/choveylee/tlog"
 )
 
-// dbLogger implements [logger.Interface], forwarding GORM log events to tlog and highlighting statements slower than 500ms.
+// dbLogger implements [logger.Interface], forwarding GORM log events to tlog and reporting slow statements
+// according to the client's slow-query settings.
 type dbLogger struct {
 	LogLevel logger.LogLevel
+
+	slowLog *slowQueryLog
 }
 
 // LogMode returns a new logger.Interface with the given log level.
@@ -48,15 +55,26 @@ func (l *dbLogger) Error(ctx context.Context, msg string, args ...interface{}) {
 	}
 }
 
-// Trace records per-statement latency. At Info level it logs executed SQL; statements slower than 500ms are reported as slow queries.
+// Trace records per-statement latency. At Info level it logs executed SQL; statements slower than the configured
+// threshold are reported as slow queries together with the calling code location, subject to the per-second budget.
+// When EXPLAIN capture is enabled, slow SELECT entries are emitted asynchronously with the query plan attached.
 // The callback fc may be invoked more than once when multiple branches apply.
 func (l *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
 	latency := time.Since(begin)
 
-	if latency > time.Millisecond*500 {
-		rawSql, _ := fc()
+	explainTarget := takeExplainTarget(ctx)
 
-		tlog.I(ctx).Msgf("Detected slow SQL statement: sql=%s latency=%s", rawSql, latency)
+	if l.slowLog != nil && l.slowLog.isSlow(latency) && l.slowLog.allow(ctx) {
+		rawSql, rowsAffected := fc()
+
+		if explainTarget != nil && l.slowLog.allowExplain() {
+			go l.slowLog.logWithPlan(context.WithoutCancel(ctx), explainTarget, rawSql, rowsAffected, latency, callerLocation())
+		} else {
+			l.slowLog.event(ctx).
+				Detailf("caller:%s", callerLocation()).
+				Detailf("rows:%d", rowsAffected).
+				Msgf("Detected slow SQL statement: sql=%s latency=%s", rawSql, latency)
+		}
 	}
 
 	if l.LogLevel == logger.Info {
@@ -66,44 +84,87 @@ func (l *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (string
 	}
 }
 
-var _ logger.Interface = &dbLogger{}
+// ParamsFilter implements [gorm.ParamsFilter]. It drops bound values when parameterized queries are enabled,
+// so logged SQL keeps its placeholders.
+func (l *dbLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.slowLog != nil && l.slowLog.parameterized.Load() {
+		return sql, nil
+	}
 
-// beforeMetricHook stores the statement start time for use by afterMetricHook.
-func beforeMetricHook(db *gorm.DB) {
-	db.Set("metric_start_time", time.Now())
+	return sql, params
 }
 
-// afterMetricHook observes elapsed time into [MysqlHistogram] after each statement.
-func afterMetricHook(db *gorm.DB) {
-	if db.Statement.Schema == nil || len(db.Statement.BuildClauses) == 0 {
-		return
-	}
-
-	sqlStatus := "SUCCESS"
-	if db.Statement.Error != nil {
-		sqlStatus = "FAILED"
-	}
+var (
+	_ logger.Interface  = &dbLogger{}
+	_ gorm.ParamsFilter = &dbLogger{}
+)
 
-	srcStartTime, ok := db.Get("metric_start_time")
-	if !ok {
-		return
-	}
+// beforeMetricHook stores the statement start time for use by the hook of newAfterMetricHook.
+func beforeMetricHook(db *gorm.DB) {
+	db.Set("metric_start_time", time.Now())
+}
 
-	startTime, ok := srcStartTime.(time.Time)
-	if !ok {
-		return
+// newAfterMetricHook returns the hook that observes elapsed time into [MysqlHistogram] after each statement, counts
+// slow statements in [MysqlSlowQueryCounter], and feeds stats when it is not nil. Raw SQL without a model schema is
+// labeled by parsing the statement.
+func newAfterMetricHook(stats *QueryStats) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		table, operation, ok := metricLabels(db)
+		if !ok {
+			return
+		}
+
+		if override, ok := metricOperation(db); ok {
+			operation = override
+		}
+
+		sqlStatus := "SUCCESS"
+		if db.Statement.Error != nil {
+			sqlStatus = "FAILED"
+
+			if isStatementTimeout(db.Statement.Error) {
+				sqlStatus = "TIMEOUT"
+			} else if errors.Is(db.Statement.Error, ErrCircuitOpen) {
+				sqlStatus = "REJECTED"
+			}
+		}
+
+		srcStartTime, ok := db.Get("metric_start_time")
+		if !ok {
+			return
+		}
+
+		startTime, ok := srcStartTime.(time.Time)
+		if !ok {
+			return
+		}
+
+		latency := time.Since(startTime)
+
+		MysqlHistogram.Observe(
+			float64(latency.Milliseconds()),
+			table,
+			operation,
+			sqlStatus,
+			mysqlNode(db),
+		)
+
+		dbLog, ok := db.Logger.(*dbLogger)
+		if ok && dbLog.slowLog != nil && dbLog.slowLog.isSlow(latency) {
+			MysqlSlowQueryCounter.Inc(table, operation)
+		}
+
+		if stats != nil && db.Statement.SQL.Len() > 0 {
+			stats.record(fingerprintOf(db), table, operation, latency, db.RowsAffected, db.Statement.Error != nil)
+		}
 	}
-
-	MysqlHistogram.Observe(
-		float64(time.Since(startTime).Milliseconds()),
-		db.Statement.Schema.Table,
-		db.Statement.BuildClauses[0],
-		sqlStatus,
-	)
 }
 
-// openDB opens a GORM DB from dsn, registers the OpenTelemetry plugin, and wires metric hooks on CRUD callbacks.
-func openDB(ctx context.Context, dsn string, logLevel logger.LogLevel) (*gorm.DB, error) {
+// openDB opens a GORM DB from dsn, registers the OpenTelemetry and optimistic-locking plugins and any extra plugins,
+// pings the primary within the configured timeout, applies statement timeouts, wires metric hooks on CRUD, Row, and Raw
+// callbacks, captures slow SELECTs for EXPLAIN, annotates transient lock errors with the victim SQL, and counts
+// statements for the [QueryRecorder] of their context. stats, when not nil, aggregates every statement.
+func openDB(ctx context.Context, dsn string, opts *mysqlOptions, stats *QueryStats) (*gorm.DB, error) {
 	dialector := mysql.Open(dsn)
 
 	otelPlugin := otelgorm.NewPlugin(
@@ -112,68 +173,198 @@ func openDB(ctx context.Context, dsn string, logLevel logger.LogLevel) (*gorm.DB
 		otelgorm.WithoutMetrics(),
 	)
 
+	versionPlugin := &versionPlugin{}
+
+	plugins := map[string]gorm.Plugin{
+		otelPlugin.Name():    otelPlugin,
+		versionPlugin.Name(): versionPlugin,
+	}
+
+	name := opts.name
+	if name == "" {
+		name = dialector.(*mysql.Dialector).DSNConfig.DBName
+	}
+
+	if opts.circuitBreaker != nil {
+		breaker := newCircuitBreaker(name, *opts.circuitBreaker)
+
+		plugins[breaker.Name()] = breaker
+	}
+
+	if opts.audit != nil {
+		audit := &auditPlugin{settings: opts.audit.withDefaults()}
+
+		plugins[audit.Name()] = audit
+	}
+
+	if opts.queryCacheRedis != nil {
+		cache := &queryCache{
+			redis:    opts.queryCacheRedis,
+			settings: opts.queryCacheSettings.withDefaults(name),
+		}
+
+		plugins[cache.Name()] = cache
+	}
+
+	for _, plugin := range opts.plugins {
+		plugins[plugin.Name()] = plugin
+	}
+
+	slowLog := newSlowQueryLog()
+	slowLog.threshold.Store(int64(opts.slowThreshold))
+
 	gormDB, err := gorm.Open(dialector, &gorm.Config{
 		Logger: &dbLogger{
-			LogLevel: logLevel,
+			LogLevel: opts.logLevel,
+
+			slowLog: slowLog,
 		},
 		NamingStrategy: schema.NamingStrategy{
-			SingularTable: false,
-		},
-		Plugins: map[string]gorm.Plugin{
-			otelPlugin.Name(): otelPlugin,
+			TablePrefix:   opts.tablePrefix,
+			SingularTable: opts.singularTable,
 		},
+		PrepareStmt:          opts.prepareStmt,
+		DisableAutomaticPing: true,
+		Plugins:              plugins,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = pingPool(ctx, sqlDB, opts.pingTimeout)
+	if err != nil {
+		_ = sqlDB.Close()
+
+		return nil, err
+	}
+
+	if opts.statementTimeout > 0 || opts.executionTimeHints {
+		timeout := &statementTimeout{
+			timeout: opts.statementTimeout,
+			hints:   opts.executionTimeHints,
+		}
+
+		err = timeout.register(gormDB)
+		if err != nil {
+			_ = sqlDB.Close()
+
+			return nil, fmt.Errorf("register mysql statement timeout: %w", err)
+		}
+	}
+
 	_ = gormDB.Callback().Query().Before("gorm:query").Register("before_query_hook", beforeMetricHook)
 	_ = gormDB.Callback().Create().Before("gorm:create").Register("before_create_hook", beforeMetricHook)
 	_ = gormDB.Callback().Update().Before("gorm:update").Register("before_update_hook", beforeMetricHook)
 	_ = gormDB.Callback().Delete().Before("gorm:delete").Register("before_delete_hook", beforeMetricHook)
+	_ = gormDB.Callback().Row().Before("gorm:row").Register("before_row_hook", beforeMetricHook)
+	_ = gormDB.Callback().Raw().Before("gorm:raw").Register("before_raw_hook", beforeMetricHook)
+	afterMetricHook := newAfterMetricHook(stats)
+
 	_ = gormDB.Callback().Query().After("gorm:query").Register("after_query_hook", afterMetricHook)
 	_ = gormDB.Callback().Create().After("gorm:create").Register("after_create_hook", afterMetricHook)
 	_ = gormDB.Callback().Update().After("gorm:update").Register("after_update_hook", afterMetricHook)
 	_ = gormDB.Callback().Delete().After("gorm:delete").Register("after_delete_hook", afterMetricHook)
+	_ = gormDB.Callback().Row().After("gorm:row").Register("after_row_hook", afterMetricHook)
+	_ = gormDB.Callback().Raw().After("gorm:raw").Register("after_raw_hook", afterMetricHook)
+
+	explainCaptureHook := newExplainCaptureHook(sqlDB)
+
+	_ = gormDB.Callback().Query().After("gorm:query").Register("explain_query_hook", explainCaptureHook)
+	_ = gormDB.Callback().Row().After("gorm:row").Register("explain_row_hook", explainCaptureHook)
+
+	_ = gormDB.Callback().Query().After("gorm:query").Register("transient_query_hook", markTransientError)
+	_ = gormDB.Callback().Create().After("gorm:create").Register("transient_create_hook", markTransientError)
+	_ = gormDB.Callback().Update().After("gorm:update").Register("transient_update_hook", markTransientError)
+	_ = gormDB.Callback().Delete().After("gorm:delete").Register("transient_delete_hook", markTransientError)
+	_ = gormDB.Callback().Row().After("gorm:row").Register("transient_row_hook", markTransientError)
+	_ = gormDB.Callback().Raw().After("gorm:raw").Register("transient_raw_hook", markTransientError)
+
+	err = registerQueryRecorder(gormDB)
+	if err != nil {
+		_ = sqlDB.Close()
+
+		return nil, fmt.Errorf("register mysql query recorder: %w", err)
+	}
 
 	return gormDB, nil
 }
 
 // MysqlClient wraps a GORM-backed MySQL connection together with SQL latency instrumentation.
+// Clients created with [NewMysqlClientWithReplicas] additionally route plain reads to replica connection pools.
+// Every client runs a background reporter that exports connection-pool gauges; call [MysqlClient.Close] to stop it
+// and release the connections.
 type MysqlClient struct {
 	db *gorm.DB
+
+	resolver *mysqlResolver
+
+	queryStats *QueryStats
+
+	name string
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closed    atomic.Bool
+	closeOnce sync.Once
 }
 
 // NewMysqlClient returns a client configured with GORM log level Error, suitable for production workloads that prefer lower log volume.
 func NewMysqlClient(ctx context.Context, dsn string) (*MysqlClient, error) {
-	db, err := openDB(ctx, dsn, logger.Error)
-	if err != nil {
-		return nil, err
-	}
+	return NewMysqlClientWithOptions(ctx, dsn, WithLogLevel(logger.Error))
+}
+
+// NewMysqlClientWithLog returns a client configured with GORM log level Info for detailed SQL tracing.
+func NewMysqlClientWithLog(ctx context.Context, dsn string) (*MysqlClient, error) {
+	return NewMysqlClientWithOptions(ctx, dsn, WithLogLevel(logger.Info))
+}
 
+// newMysqlClient wraps an opened GORM DB and an optional replica resolver, labels the client with name,
+// and starts the pool metrics reporter goroutine.
+func newMysqlClient(db *gorm.DB, resolver *mysqlResolver, name string) *MysqlClient {
 	mysqlClient := &MysqlClient{
 		db: db,
-	}
 
-	return mysqlClient, nil
-}
+		resolver: resolver,
 
-// NewMysqlClientWithLog returns a client configured with GORM log level Info for detailed SQL tracing.
-func NewMysqlClientWithLog(ctx context.Context, dsn string) (*MysqlClient, error) {
-	gormDb, err := openDB(ctx, dsn, logger.Info)
-	if err != nil {
-		return nil, err
+		name: name,
+
+		stop: make(chan struct{}),
 	}
 
-	mysqlClient := &MysqlClient{
-		db: gormDb,
+	mysqlClient.wg.Add(1)
+
+	go mysqlClient.runPoolMetricsReporter()
+
+	return mysqlClient
+}
+
+// mysqlDBName returns the database name from the DSN of db, or an empty string for non-MySQL dialectors.
+func mysqlDBName(db *gorm.DB) string {
+	dialector, ok := db.Dialector.(*mysql.Dialector)
+	if !ok || dialector.DSNConfig == nil {
+		return ""
 	}
 
-	return mysqlClient, nil
+	return dialector.DSNConfig.DBName
 }
 
 // DB returns a context-bound [gorm.DB]. When runMode is [DebugMode], the returned session has GORM Debug logging enabled.
+// When ctx carries a transaction started by [MysqlClient.WithTx] on this client, the returned session joins it.
+// After [MysqlClient.Close], every statement on a session outside such a transaction fails with [ErrClientClosed].
 func (p *MysqlClient) DB(ctx context.Context, runMode string) *gorm.DB {
+	if ambient := p.ambientTx(ctx); ambient != nil {
+		return ambient.session(ctx, runMode)
+	}
+
+	if p.closed.Load() {
+		return p.closedDB(ctx)
+	}
+
 	if runMode == DebugMode {
 		return p.db.WithContext(ctx).Debug()
 	}
@@ -183,7 +374,21 @@ func (p *MysqlClient) DB(ctx context.Context, runMode string) *gorm.DB {
 
 // Tx begins a transaction and returns a [gorm.DB]. The caller must Commit or Rollback the returned session.
 // When runMode is [DebugMode], the transaction is created with GORM Debug logging enabled.
+// After [MysqlClient.Close], the returned session carries [ErrClientClosed] and no transaction is started; while the
+// circuit breaker is open, it carries [ErrCircuitOpen].
 func (p *MysqlClient) Tx(ctx context.Context, runMode string) *gorm.DB {
+	if p.closed.Load() {
+		return p.closedDB(ctx)
+	}
+
+	if breaker := p.circuitBreaker(); breaker != nil && breaker.rejects() {
+		db := p.db.WithContext(ctx)
+
+		db.Error = ErrCircuitOpen
+
+		return db
+	}
+
 	if runMode == DebugMode {
 		return p.db.WithContext(ctx).Debug().Begin()
 	}
@@ -191,7 +396,7 @@ func (p *MysqlClient) Tx(ctx context.Context, runMode string) *gorm.DB {
 	return p.db.WithContext(ctx).Begin()
 }
 
-// SetMaxOpenConns sets the maximum number of open connections on the underlying sql.DB.
+// SetMaxOpenConns sets the maximum number of open connections on the underlying sql.DB and on every replica pool.
 func (p *MysqlClient) SetMaxOpenConns(maxOpenConns int) error {
 	sqlDB, err := p.db.DB()
 	if err != nil {
@@ -200,10 +405,16 @@ func (p *MysqlClient) SetMaxOpenConns(maxOpenConns int) error {
 
 	sqlDB.SetMaxOpenConns(maxOpenConns)
 
+	if p.resolver != nil {
+		for _, pool := range p.resolver.pools() {
+			pool.SetMaxOpenConns(maxOpenConns)
+		}
+	}
+
 	return nil
 }
 
-// SetMaxIdleConns sets the maximum number of idle connections on the underlying sql.DB.
+// SetMaxIdleConns sets the maximum number of idle connections on the underlying sql.DB and on every replica pool.
 func (p *MysqlClient) SetMaxIdleConns(maxIdleConns int) error {
 	sqlDB, err := p.db.DB()
 	if err != nil {
@@ -212,6 +423,12 @@ func (p *MysqlClient) SetMaxIdleConns(maxIdleConns int) error {
 
 	sqlDB.SetMaxIdleConns(maxIdleConns)
 
+	if p.resolver != nil {
+		for _, pool := range p.resolver.pools() {
+			pool.SetMaxIdleConns(maxIdleConns)
+		}
+	}
+
 	return nil
 }
 
@@ -224,6 +441,12 @@ func (p *MysqlClient) SetConnMaxLifetime(connMaxLifetime time.Duration) error {
 
 	sqlDB.SetConnMaxLifetime(connMaxLifetime)
 
+	if p.resolver != nil {
+		for _, pool := range p.resolver.pools() {
+			pool.SetConnMaxLifetime(connMaxLifetime)
+		}
+	}
+
 	return nil
 }
 
@@ -236,5 +459,11 @@ func (p *MysqlClient) SetConnMaxIdleTime(connMaxIdleTime time.Duration) error {
 
 	sqlDB.SetConnMaxIdleTime(connMaxIdleTime)
 
+	if p.resolver != nil {
+		for _, pool := range p.resolver.pools() {
+			pool.SetConnMaxIdleTime(connMaxIdleTime)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,519 @@
+package tdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	auditPluginName = "tdb:audit"
+
+	auditOldValuesKey = "tdb:audit_old_values"
+
+	auditCreate = "CREATE"
+	auditUpsert = "UPSERT"
+	auditUpdate = "UPDATE"
+	auditDelete = "DELETE"
+)
+
+// AuditSettings configures the plugin installed by [WithAudit]. Empty column names use the defaults documented on
+// each field; a model without one of the columns is simply not stamped with it.
+type AuditSettings struct {
+	// CreatedByColumn receives the actor on create. The default is created_by.
+	CreatedByColumn string
+
+	// UpdatedByColumn receives the actor on create and update. The default is updated_by.
+	UpdatedByColumn string
+
+	// DeletedByColumn receives the actor when a model with a [gorm.DeletedAt] field is soft-deleted.
+	// The default is deleted_by.
+	DeletedByColumn string
+
+	// CreatedAtColumn receives the UTC time on create unless GORM already manages it. The default is created_at.
+	CreatedAtColumn string
+
+	// UpdatedAtColumn receives the UTC time on create and update unless GORM already manages it.
+	// The default is updated_at.
+	UpdatedAtColumn string
+
+	// TrailTable enables a row-level audit trail written to this table in the transaction of the change.
+	// The table needs the columns table_name, primary_key, operation, actor, old_values (JSON, nullable),
+	// new_values (JSON, nullable), and created_at. Empty disables the trail.
+	TrailTable string
+}
+
+// withDefaults returns p with empty column names replaced by their defaults.
+func (p AuditSettings) withDefaults() AuditSettings {
+	if p.CreatedByColumn == "" {
+		p.CreatedByColumn = "created_by"
+	}
+
+	if p.UpdatedByColumn == "" {
+		p.UpdatedByColumn = "updated_by"
+	}
+
+	if p.DeletedByColumn == "" {
+		p.DeletedByColumn = "deleted_by"
+	}
+
+	if p.CreatedAtColumn == "" {
+		p.CreatedAtColumn = "created_at"
+	}
+
+	if p.UpdatedAtColumn == "" {
+		p.UpdatedAtColumn = "updated_at"
+	}
+
+	return p
+}
+
+type actorCtxKey struct{}
+
+// WithActor returns a context whose writes are attributed to actor by the plugin installed with [WithAudit].
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by [WithActor].
+func ActorFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	actor, ok := ctx.Value(actorCtxKey{}).(string)
+
+	return actor, ok && actor != ""
+}
+
+// auditPlugin stamps audit columns and records the audit trail.
+type auditPlugin struct {
+	settings AuditSettings
+}
+
+// Name implements [gorm.Plugin].
+func (p *auditPlugin) Name() string {
+	return auditPluginName
+}
+
+// Initialize implements [gorm.Plugin]. It also switches GORM's clock to UTC, so automatically managed timestamps
+// and soft-delete times match the columns stamped by the plugin. The trail is written before GORM commits the
+// transaction it opens around a single Create, Update, or Delete, so a failed trail write rolls the change back.
+func (p *auditPlugin) Initialize(db *gorm.DB) error {
+	db.Config.NowFunc = func() time.Time {
+		return time.Now().UTC()
+	}
+
+	return errors.Join(
+		db.Callback().Create().Before("gorm:create").Register("tdb:audit_before_create", p.beforeCreate),
+		db.Callback().Update().Before("gorm:update").Register("tdb:audit_before_update", p.beforeUpdate),
+		db.Callback().Delete().Before("gorm:delete").Register("tdb:audit_before_delete", p.beforeDelete),
+		db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+			Register("tdb:audit_after_create", p.afterCreate),
+		db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+			Register("tdb:audit_after_update", p.afterUpdate),
+		db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+			Register("tdb:audit_after_delete", p.afterDelete),
+	)
+}
+
+// audited reports whether the statement writes a model other than the trail table itself.
+func (p *auditPlugin) audited(db *gorm.DB) bool {
+	return db.Error == nil && db.Statement.Schema != nil && db.Statement.Table != p.settings.TrailTable
+}
+
+// beforeCreate fills the actor and time columns of every created row that leaves them empty.
+func (p *auditPlugin) beforeCreate(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+
+	stmt := db.Statement
+	actor, hasActor := ActorFromContext(stmt.Context)
+	now := db.NowFunc()
+
+	stampRow := func(rowValue reflect.Value) {
+		rowValue = reflect.Indirect(rowValue)
+		if rowValue.Kind() != reflect.Struct || !rowValue.CanAddr() {
+			return
+		}
+
+		if hasActor {
+			p.stampZero(db, rowValue, p.settings.CreatedByColumn, actor)
+			p.stampZero(db, rowValue, p.settings.UpdatedByColumn, actor)
+		}
+
+		if field := auditTimeField(stmt.Schema, p.settings.CreatedAtColumn); field != nil && field.AutoCreateTime == 0 {
+			p.stampZero(db, rowValue, field.DBName, now)
+		}
+
+		if field := auditTimeField(stmt.Schema, p.settings.UpdatedAtColumn); field != nil && field.AutoUpdateTime == 0 {
+			p.stampZero(db, rowValue, field.DBName, now)
+		}
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			stampRow(stmt.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		stampRow(stmt.ReflectValue)
+	}
+}
+
+// stampZero sets column of rowValue to value when the model has the column and it is still zero.
+func (p *auditPlugin) stampZero(db *gorm.DB, rowValue reflect.Value, column string, value any) {
+	field := db.Statement.Schema.LookUpField(column)
+	if field == nil || field.DBName == "" {
+		return
+	}
+
+	if _, isZero := field.ValueOf(db.Statement.Context, rowValue); isZero {
+		_ = db.AddError(field.Set(db.Statement.Context, rowValue, value))
+	}
+}
+
+// beforeUpdate writes the actor and time columns along with the update and loads the old row for the trail.
+func (p *auditPlugin) beforeUpdate(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+
+	stmt := db.Statement
+
+	if actor, ok := ActorFromContext(stmt.Context); ok {
+		p.setColumn(db, p.settings.UpdatedByColumn, actor)
+	}
+
+	if field := auditTimeField(stmt.Schema, p.settings.UpdatedAtColumn); field != nil && field.AutoUpdateTime == 0 {
+		p.setColumn(db, field.DBName, db.NowFunc())
+	}
+
+	p.loadOldValues(db)
+}
+
+// setColumn adds column = value to the update, also when the update is restricted with Select.
+func (p *auditPlugin) setColumn(db *gorm.DB, column string, value any) {
+	stmt := db.Statement
+
+	field := stmt.Schema.LookUpField(column)
+	if field == nil || field.DBName == "" {
+		return
+	}
+
+	if len(stmt.Selects) > 0 && !slices.Contains(stmt.Selects, "*") && !slices.Contains(stmt.Selects, field.DBName) {
+		stmt.Selects = append(stmt.Selects, field.DBName)
+	}
+
+	stmt.SetColumn(field.DBName, value, true)
+}
+
+// beforeDelete adds the actor to soft deletes and loads the old row for the trail.
+func (p *auditPlugin) beforeDelete(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+
+	stmt := db.Statement
+
+	if actor, ok := ActorFromContext(stmt.Context); ok && !stmt.Unscoped && isSoftDelete(stmt.Schema) {
+		field := stmt.Schema.LookUpField(p.settings.DeletedByColumn)
+		if field != nil && field.DBName != "" {
+			// GORM replaces the SET expression of a soft delete, but keeps the clause's trailing expression.
+			setClause := stmt.Clauses["SET"]
+			setClause.AfterExpression = clause.Expr{
+				SQL:  ", ? = ?",
+				Vars: []any{clause.Column{Name: field.DBName}, actor},
+			}
+
+			stmt.Clauses["SET"] = setClause
+		}
+	}
+
+	p.loadOldValues(db)
+}
+
+// loadOldValues reads the current row of a single loaded model, within the statement's transaction, so that the
+// trail can record what changed. Bulk statements without a loaded model are not recorded.
+func (p *auditPlugin) loadOldValues(db *gorm.DB) {
+	if p.settings.TrailTable == "" {
+		return
+	}
+
+	stmt := db.Statement
+
+	pkConds, ok := auditPrimaryKeyConds(stmt)
+	if !ok {
+		return
+	}
+
+	fetch := db.Session(&gorm.Session{NewDB: true}).Table(stmt.Table).Where(clause.And(pkConds...))
+
+	if whereClause, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := whereClause.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			fetch = fetch.Where(clause.And(where.Exprs...))
+		}
+	}
+
+	oldValues := make(map[string]any)
+
+	err := fetch.Take(&oldValues).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("load audit row: %w", err))
+
+		return
+	}
+
+	db.Set(auditOldValuesKey, oldValues)
+}
+
+// afterCreate records every created row.
+func (p *auditPlugin) afterCreate(db *gorm.DB) {
+	if p.settings.TrailTable == "" || !p.audited(db) {
+		return
+	}
+
+	stmt := db.Statement
+
+	operation := auditCreate
+	if _, ok := stmt.Clauses["ON CONFLICT"]; ok {
+		operation = auditUpsert
+	}
+
+	rows := make([]map[string]any, 0, 1)
+
+	appendRow := func(rowValue reflect.Value) {
+		rowValue = reflect.Indirect(rowValue)
+		if rowValue.Kind() != reflect.Struct {
+			return
+		}
+
+		newValues := make(map[string]any, len(stmt.Schema.DBNames))
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+
+			value, _ := field.ValueOf(stmt.Context, rowValue)
+
+			newValues[field.DBName] = auditValue(value)
+		}
+
+		rows = append(rows, p.trailRow(db, operation, auditPrimaryKey(stmt, rowValue), nil, newValues))
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			appendRow(stmt.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		appendRow(stmt.ReflectValue)
+	}
+
+	p.writeTrail(db, rows)
+}
+
+// afterUpdate records the changed columns of a single loaded model.
+func (p *auditPlugin) afterUpdate(db *gorm.DB) {
+	oldValues, ok := takeAuditOldValues(db)
+	if !ok || !p.audited(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	stmt := db.Statement
+
+	setClause, ok := stmt.Clauses["SET"].Expression.(clause.Set)
+	if !ok {
+		return
+	}
+
+	changedOld := make(map[string]any)
+	changedNew := make(map[string]any)
+
+	for _, assignment := range setClause {
+		newValue := auditValue(assignment.Value)
+
+		if expr, ok := assignment.Value.(clause.Expr); ok {
+			newValue = expr.SQL
+		}
+
+		oldValue := auditValue(oldValues[assignment.Column.Name])
+
+		if fmt.Sprint(oldValue) == fmt.Sprint(newValue) {
+			continue
+		}
+
+		changedOld[assignment.Column.Name] = oldValue
+		changedNew[assignment.Column.Name] = newValue
+	}
+
+	if len(changedNew) == 0 {
+		return
+	}
+
+	primaryKey := auditPrimaryKey(stmt, reflect.Indirect(stmt.ReflectValue))
+
+	p.writeTrail(db, []map[string]any{p.trailRow(db, auditUpdate, primaryKey, changedOld, changedNew)})
+}
+
+// afterDelete records the deleted row of a single loaded model.
+func (p *auditPlugin) afterDelete(db *gorm.DB) {
+	oldValues, ok := takeAuditOldValues(db)
+	if !ok || !p.audited(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	for column, value := range oldValues {
+		oldValues[column] = auditValue(value)
+	}
+
+	primaryKey := auditPrimaryKey(db.Statement, reflect.Indirect(db.Statement.ReflectValue))
+
+	p.writeTrail(db, []map[string]any{p.trailRow(db, auditDelete, primaryKey, oldValues, nil)})
+}
+
+// trailRow builds one row of the trail table.
+func (p *auditPlugin) trailRow(db *gorm.DB, operation, primaryKey string, oldValues, newValues map[string]any) map[string]any {
+	actor, _ := ActorFromContext(db.Statement.Context)
+
+	return map[string]any{
+		"table_name":  db.Statement.Table,
+		"primary_key": primaryKey,
+		"operation":   operation,
+		"actor":       actor,
+		"old_values":  auditJSON(oldValues),
+		"new_values":  auditJSON(newValues),
+		"created_at":  db.NowFunc(),
+	}
+}
+
+// writeTrail inserts rows into the trail table on the statement's connection, which is the transaction that wraps
+// the audited change.
+func (p *auditPlugin) writeTrail(db *gorm.DB, rows []map[string]any) {
+	if len(rows) == 0 {
+		return
+	}
+
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(p.settings.TrailTable).Create(&rows).Error
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("write audit trail: %w", err))
+	}
+}
+
+func takeAuditOldValues(db *gorm.DB) (map[string]any, bool) {
+	value, ok := db.Get(auditOldValuesKey)
+	if !ok {
+		return nil, false
+	}
+
+	db.Statement.Settings.Delete(auditOldValuesKey)
+
+	oldValues, ok := value.(map[string]any)
+
+	return oldValues, ok
+}
+
+// auditPrimaryKeyConds returns equality conditions on the primary key of a single loaded model.
+func auditPrimaryKeyConds(stmt *gorm.Statement) ([]clause.Expression, bool) {
+	rowValue := reflect.Indirect(stmt.ReflectValue)
+	if rowValue.Kind() != reflect.Struct || len(stmt.Schema.PrimaryFields) == 0 {
+		return nil, false
+	}
+
+	conds := make([]clause.Expression, 0, len(stmt.Schema.PrimaryFields))
+
+	for _, field := range stmt.Schema.PrimaryFields {
+		value, isZero := field.ValueOf(stmt.Context, rowValue)
+		if isZero {
+			return nil, false
+		}
+
+		conds = append(conds, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+	}
+
+	return conds, true
+}
+
+// auditPrimaryKey formats the primary key of rowValue, joining composite keys with commas.
+func auditPrimaryKey(stmt *gorm.Statement, rowValue reflect.Value) string {
+	parts := make([]string, 0, len(stmt.Schema.PrimaryFields))
+
+	for _, field := range stmt.Schema.PrimaryFields {
+		value, _ := field.ValueOf(stmt.Context, rowValue)
+
+		parts = append(parts, fmt.Sprint(auditValue(value)))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// auditTimeField returns the time.Time field stored in column, or nil.
+func auditTimeField(modelSchema *schema.Schema, column string) *schema.Field {
+	field := modelSchema.LookUpField(column)
+	if field == nil || field.DBName == "" || field.IndirectFieldType != reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+
+	return field
+}
+
+// isSoftDelete reports whether deletes of the model are turned into updates by a [gorm.DeletedAt] field.
+func isSoftDelete(modelSchema *schema.Schema) bool {
+	for _, deleteClause := range modelSchema.DeleteClauses {
+		if _, ok := deleteClause.(gorm.SoftDeleteDeleteClause); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// auditValue converts value into a form that encodes predictably as JSON.
+func auditValue(value any) any {
+	if valuer, ok := value.(driver.Valuer); ok {
+		driverValue, err := valuer.Value()
+		if err == nil {
+			value = driverValue
+		}
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC()
+	default:
+		return v
+	}
+}
+
+// auditJSON encodes values, returning nil for an absent side of the change so it is stored as NULL.
+func auditJSON(values map[string]any) any {
+	if values == nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,396 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/choveylee/tlog"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	circuitBreakerPluginName = "tdb:circuit_breaker"
+
+	circuitAdmissionKey = "tdb:circuit_admission"
+
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+
+	// MySQL errors that indicate an overloaded or unavailable server rather than a faulty statement.
+	mysqlErrTooManyConnections     = 1040
+	mysqlErrTooManyUserConnections = 1203
+	mysqlErrQueryInterrupted       = 1317
+)
+
+// ErrCircuitOpen is returned by statements and transactions that the circuit breaker rejects without contacting
+// the database.
+var ErrCircuitOpen = errors.New("mysql circuit breaker is open")
+
+// CircuitBreakerSettings configures the breaker installed by [WithCircuitBreaker]. Zero fields use the defaults
+// documented on each field.
+type CircuitBreakerSettings struct {
+	// Window is the length of the fixed window in which outcomes are counted. The default is 10s.
+	Window time.Duration
+
+	// MinRequests is the number of statements a window must contain before the breaker may trip. The default is 20.
+	MinRequests int
+
+	// ErrorRate is the fraction of failed statements in a window that trips the breaker. The default is 0.5.
+	// Only timeouts, connection failures, and server overload errors count as failures. A timeout counts when the
+	// server reports it or the client's default statement timeout expires; a statement abandoned because its caller's
+	// context was canceled or reached its own deadline does not.
+	ErrorRate float64
+
+	// SlowThreshold marks statements at least this slow. The default is 1s.
+	SlowThreshold time.Duration
+
+	// SlowRate is the fraction of slow statements in a window that trips the breaker. The default is 0.8.
+	SlowRate float64
+
+	// OpenDuration is how long the breaker rejects statements before letting probes through. The default is 5s.
+	OpenDuration time.Duration
+
+	// HalfOpenProbes is the number of probe statements admitted while half-open; the breaker closes when all of them
+	// succeed and opens again on the first failure. A probe that has not finished within SlowThreshold of the last
+	// probe's admission, such as one aborted before reaching the database, counts as slow. The default is 3.
+	HalfOpenProbes int
+}
+
+// withDefaults returns p with zero fields replaced by their defaults.
+func (p CircuitBreakerSettings) withDefaults() CircuitBreakerSettings {
+	if p.Window <= 0 {
+		p.Window = 10 * time.Second
+	}
+
+	if p.MinRequests <= 0 {
+		p.MinRequests = 20
+	}
+
+	if p.ErrorRate <= 0 {
+		p.ErrorRate = 0.5
+	}
+
+	if p.SlowThreshold <= 0 {
+		p.SlowThreshold = time.Second
+	}
+
+	if p.SlowRate <= 0 {
+		p.SlowRate = 0.8
+	}
+
+	if p.OpenDuration <= 0 {
+		p.OpenDuration = 5 * time.Second
+	}
+
+	if p.HalfOpenProbes <= 0 {
+		p.HalfOpenProbes = 3
+	}
+
+	return p
+}
+
+// circuitAdmission records how a statement was admitted and when it started.
+type circuitAdmission struct {
+	probe      bool
+	generation uint64
+	startTime  time.Time
+
+	// callerCtx is the statement's context before the default statement timeout was applied.
+	callerCtx context.Context
+}
+
+// circuitBreaker rejects statements while the database is failing or overloaded. It is installed as a GORM
+// plugin so that the owning [MysqlClient] can find it and also refuse new transactions while open.
+type circuitBreaker struct {
+	name     string
+	settings CircuitBreakerSettings
+
+	mu    sync.Mutex
+	state string
+
+	windowStart time.Time
+	total       int
+	failures    int
+	slow        int
+
+	openedAt time.Time
+
+	// generation counts transitions, so that a probe admitted in an earlier half-open period is not counted in a
+	// later one.
+	generation uint64
+
+	probesAdmitted  int
+	probesSucceeded int
+	probeDeadline   time.Time
+}
+
+func newCircuitBreaker(name string, settings CircuitBreakerSettings) *circuitBreaker {
+	breaker := &circuitBreaker{
+		name:     name,
+		settings: settings.withDefaults(),
+
+		state: circuitClosed,
+
+		windowStart: time.Now(),
+	}
+
+	reportCircuitState(name, circuitClosed)
+
+	return breaker
+}
+
+// Name implements [gorm.Plugin].
+func (p *circuitBreaker) Name() string {
+	return circuitBreakerPluginName
+}
+
+// Initialize implements [gorm.Plugin]. The admission check runs before every other callback, so a rejected
+// statement never begins a transaction or takes a connection.
+func (p *circuitBreaker) Initialize(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Query().Before("*").Register("tdb:circuit_before_query", p.before),
+		db.Callback().Row().Before("*").Register("tdb:circuit_before_row", p.before),
+		db.Callback().Raw().Before("*").Register("tdb:circuit_before_raw", p.before),
+		db.Callback().Create().Before("*").Register("tdb:circuit_before_create", p.before),
+		db.Callback().Update().Before("*").Register("tdb:circuit_before_update", p.before),
+		db.Callback().Delete().Before("*").Register("tdb:circuit_before_delete", p.before),
+		db.Callback().Query().After("*").Register("tdb:circuit_after_query", p.after),
+		db.Callback().Row().After("*").Register("tdb:circuit_after_row", p.after),
+		db.Callback().Raw().After("*").Register("tdb:circuit_after_raw", p.after),
+		db.Callback().Create().After("*").Register("tdb:circuit_after_create", p.after),
+		db.Callback().Update().After("*").Register("tdb:circuit_after_update", p.after),
+		db.Callback().Delete().After("*").Register("tdb:circuit_after_delete", p.after),
+	)
+}
+
+func (p *circuitBreaker) before(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	admission, admitted := p.admit()
+	if !admitted {
+		_ = db.AddError(ErrCircuitOpen)
+
+		return
+	}
+
+	admission.callerCtx = db.Statement.Context
+	if admission.callerCtx == nil {
+		admission.callerCtx = context.Background()
+	}
+
+	db.Set(circuitAdmissionKey, admission)
+}
+
+func (p *circuitBreaker) after(db *gorm.DB) {
+	value, ok := db.Get(circuitAdmissionKey)
+	if !ok {
+		return
+	}
+
+	db.Statement.Settings.Delete(circuitAdmissionKey)
+
+	admission, ok := value.(*circuitAdmission)
+	if !ok {
+		return
+	}
+
+	failed := isCircuitFailure(admission.callerCtx, db.Error)
+	slow := time.Since(admission.startTime) >= p.settings.SlowThreshold
+
+	p.record(db.Statement.Context, admission, failed, slow)
+}
+
+// admit decides whether a statement may run and, if so, how it was admitted.
+func (p *circuitBreaker) admit() (*circuitAdmission, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	switch p.state {
+	case circuitClosed:
+		return &circuitAdmission{generation: p.generation, startTime: now}, true
+	case circuitOpen:
+		if now.Sub(p.openedAt) < p.settings.OpenDuration {
+			return nil, false
+		}
+
+		p.transition(context.Background(), circuitHalfOpen)
+	}
+
+	if p.probesAdmitted >= p.settings.HalfOpenProbes {
+		// Probes that never reported, such as statements aborted before reaching the database, would otherwise keep
+		// the breaker half-open for good.
+		if now.After(p.probeDeadline) {
+			tlog.W(context.Background()).Msgf("MySQL circuit breaker of %q timed out waiting for probes.", p.name)
+
+			p.transition(context.Background(), circuitOpen)
+		}
+
+		return nil, false
+	}
+
+	p.probesAdmitted++
+	p.probeDeadline = now.Add(p.settings.SlowThreshold)
+
+	return &circuitAdmission{probe: true, generation: p.generation, startTime: now}, true
+}
+
+// rejects reports whether new work should be refused without consuming a half-open probe.
+func (p *circuitBreaker) rejects() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.state == circuitOpen && time.Since(p.openedAt) < p.settings.OpenDuration
+}
+
+// record accounts the outcome of an admitted statement and trips or resets the breaker.
+func (p *circuitBreaker) record(ctx context.Context, admission *circuitAdmission, failed, slow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if admission.probe {
+		if p.state != circuitHalfOpen || admission.generation != p.generation {
+			return
+		}
+
+		if failed || slow {
+			p.transition(ctx, circuitOpen)
+
+			return
+		}
+
+		p.probesSucceeded++
+		if p.probesSucceeded >= p.settings.HalfOpenProbes {
+			p.transition(ctx, circuitClosed)
+		}
+
+		return
+	}
+
+	if p.state != circuitClosed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(p.windowStart) >= p.settings.Window {
+		p.resetWindow(now)
+	}
+
+	p.total++
+
+	if failed {
+		p.failures++
+	}
+
+	if slow {
+		p.slow++
+	}
+
+	if p.total < p.settings.MinRequests {
+		return
+	}
+
+	if float64(p.failures) >= p.settings.ErrorRate*float64(p.total) ||
+		float64(p.slow) >= p.settings.SlowRate*float64(p.total) {
+		p.transition(ctx, circuitOpen)
+	}
+}
+
+// transition moves the breaker to state; the caller holds p.mu.
+func (p *circuitBreaker) transition(ctx context.Context, state string) {
+	previous := p.state
+
+	p.state = state
+	p.generation++
+	p.probesAdmitted = 0
+	p.probesSucceeded = 0
+
+	switch state {
+	case circuitOpen:
+		p.openedAt = time.Now()
+
+		event := tlog.W(ctx)
+		if previous == circuitClosed {
+			event = event.Detailf("failures:%d", p.failures).Detailf("slow:%d", p.slow).Detailf("total:%d", p.total)
+		}
+
+		event.Msgf("MySQL circuit breaker of %q opened from %s.", p.name, previous)
+	case circuitClosed:
+		tlog.I(ctx).Msgf("MySQL circuit breaker of %q closed.", p.name)
+	}
+
+	p.resetWindow(time.Now())
+
+	reportCircuitState(p.name, state)
+}
+
+func (p *circuitBreaker) resetWindow(now time.Time) {
+	p.windowStart = now
+	p.total = 0
+	p.failures = 0
+	p.slow = 0
+}
+
+// reportCircuitState sets [MysqlCircuitStateGauge] to 1 for the current state of the named client and 0 otherwise.
+func reportCircuitState(name, state string) {
+	for _, circuitState := range []string{circuitClosed, circuitOpen, circuitHalfOpen} {
+		value := 0.0
+		if circuitState == state {
+			value = 1
+		}
+
+		MysqlCircuitStateGauge.Set(value, name, circuitState)
+	}
+}
+
+// isCircuitFailure reports whether err indicates an unhealthy database: a timeout, a broken connection, or an
+// overload error. Statement-level errors such as constraint violations or missing rows do not count, and neither
+// does anything that happens once callerCtx is done: the caller gave up, which says nothing about the database.
+// A deadline that expires while callerCtx is still live is the client's default statement timeout.
+func isCircuitFailure(callerCtx context.Context, err error) bool {
+	if err == nil || callerCtx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysqldriver.ErrInvalidConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrQueryTimeout, mysqlErrTooManyConnections, mysqlErrTooManyUserConnections, mysqlErrQueryInterrupted:
+			return true
+		}
+	}
+
+	return false
+}
+
+// circuitBreaker returns the breaker installed with [WithCircuitBreaker], or nil.
+func (p *MysqlClient) circuitBreaker() *circuitBreaker {
+	plugin, ok := p.db.Config.Plugins[circuitBreakerPluginName]
+	if !ok {
+		return nil
+	}
+
+	breaker, _ := plugin.(*circuitBreaker)
+
+	return breaker
+}
@@ -0,0 +1,175 @@
+package tdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestIsCircuitFailure(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		callerCtx context.Context
+		err       error
+		want      bool
+	}{
+		{name: "no error", err: nil, want: false},
+		{name: "missing row", err: gorm.ErrRecordNotFound, want: false},
+		{name: "duplicate key", err: &mysqldriver.MySQLError{Number: 1062}, want: false},
+		{name: "default statement timeout", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: true},
+		{name: "caller deadline", callerCtx: canceledCtx, err: context.DeadlineExceeded, want: false},
+		{name: "caller cancellation", callerCtx: canceledCtx, err: context.Canceled, want: false},
+		{name: "cancellation", err: context.Canceled, want: false},
+		{name: "broken connection after cancellation", callerCtx: canceledCtx, err: driver.ErrBadConn, want: false},
+		{name: "server timeout", err: &mysqldriver.MySQLError{Number: mysqlErrQueryTimeout}, want: true},
+		{name: "too many connections", err: &mysqldriver.MySQLError{Number: mysqlErrTooManyConnections}, want: true},
+		{name: "broken connection", err: driver.ErrBadConn, want: true},
+		{name: "invalid connection", err: mysqldriver.ErrInvalidConn, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callerCtx := tt.callerCtx
+			if callerCtx == nil {
+				callerCtx = context.Background()
+			}
+
+			got := isCircuitFailure(callerCtx, tt.err)
+			if got != tt.want {
+				t.Errorf("isCircuitFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	settings := CircuitBreakerSettings{
+		MinRequests:    2,
+		SlowThreshold:  20 * time.Millisecond,
+		OpenDuration:   time.Millisecond,
+		HalfOpenProbes: 2,
+	}
+
+	open := func(t *testing.T) *circuitBreaker {
+		t.Helper()
+
+		breaker := newCircuitBreaker(t.Name(), settings)
+
+		for i := 0; i < 2; i++ {
+			admission, _ := breaker.admit()
+			breaker.record(context.Background(), admission, true, false)
+		}
+
+		if breaker.state != circuitOpen {
+			t.Fatalf("state = %s, want %s", breaker.state, circuitOpen)
+		}
+
+		time.Sleep(settings.OpenDuration)
+
+		return breaker
+	}
+
+	t.Run("probes close", func(t *testing.T) {
+		breaker := open(t)
+
+		first, ok := breaker.admit()
+		second, _ := breaker.admit()
+
+		if !ok || !first.probe || !second.probe || breaker.state != circuitHalfOpen {
+			t.Fatalf("admit() did not admit probes while half-open")
+		}
+
+		_, ok = breaker.admit()
+		if ok {
+			t.Error("admit() admitted more probes than HalfOpenProbes")
+		}
+
+		breaker.record(context.Background(), first, false, false)
+		breaker.record(context.Background(), second, false, false)
+
+		if breaker.state != circuitClosed {
+			t.Errorf("state = %s, want %s", breaker.state, circuitClosed)
+		}
+	})
+
+	t.Run("failed probe reopens", func(t *testing.T) {
+		breaker := open(t)
+
+		probe, _ := breaker.admit()
+		breaker.record(context.Background(), probe, true, false)
+
+		if breaker.state != circuitOpen {
+			t.Errorf("state = %s, want %s", breaker.state, circuitOpen)
+		}
+	})
+
+	t.Run("lost probe reopens", func(t *testing.T) {
+		breaker := open(t)
+
+		first, _ := breaker.admit()
+		_, _ = breaker.admit()
+
+		breaker.record(context.Background(), first, false, false)
+
+		time.Sleep(settings.SlowThreshold)
+
+		_, ok := breaker.admit()
+		if ok || breaker.state != circuitOpen {
+			t.Fatalf("state = %s after a lost probe, want %s", breaker.state, circuitOpen)
+		}
+
+		time.Sleep(settings.OpenDuration)
+
+		probe, ok := breaker.admit()
+		if !ok || !probe.probe {
+			t.Error("admit() did not admit a probe after reopening")
+		}
+	})
+
+	t.Run("stale probe is ignored", func(t *testing.T) {
+		breaker := open(t)
+
+		stale, _ := breaker.admit()
+		failed, _ := breaker.admit()
+
+		breaker.record(context.Background(), failed, true, false)
+		time.Sleep(settings.OpenDuration)
+
+		_, _ = breaker.admit()
+
+		breaker.record(context.Background(), stale, false, false)
+
+		if breaker.probesSucceeded != 0 {
+			t.Errorf("probesSucceeded = %d, want the stale probe ignored", breaker.probesSucceeded)
+		}
+	})
+}
+
+func TestCircuitBreakerIgnoresCallerErrors(t *testing.T) {
+	breaker := newCircuitBreaker(t.Name(), CircuitBreakerSettings{MinRequests: 2})
+
+	for i := 0; i < 4; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		db := &gorm.DB{Statement: &gorm.Statement{Context: ctx}}
+
+		breaker.before(db)
+		cancel()
+
+		db.Error = errors.Join(context.Canceled, driver.ErrBadConn)
+		breaker.after(db)
+	}
+
+	if breaker.state != circuitClosed {
+		t.Errorf("state = %s, want %s", breaker.state, circuitClosed)
+	}
+}
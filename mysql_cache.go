@@ -0,0 +1,590 @@
+package tdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choveylee/tlog"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	queryCachePluginName = "tdb:query_cache"
+
+	queryCacheTTLKey = "tdb:query_cache_ttl"
+
+	queryCacheHit   = "hit"
+	queryCacheMiss  = "miss"
+	queryCacheError = "error"
+)
+
+// QueryCacheSettings configures the cache installed by [WithQueryCache]. Zero fields use the defaults documented on
+// each field.
+type QueryCacheSettings struct {
+	// TTL is how long a cached result is served when the query does not set its own. The default is 1m.
+	TTL time.Duration
+
+	// KeyPrefix prefixes every Redis key of the cache. The default is tdb:qc: followed by the client name and a colon.
+	KeyPrefix string
+
+	// MaxResultBytes is the largest encoded result that is stored; larger results are returned but not cached.
+	// The default is 1 MiB.
+	MaxResultBytes int
+}
+
+// withDefaults returns p with zero fields replaced by their defaults.
+func (p QueryCacheSettings) withDefaults(name string) QueryCacheSettings {
+	if p.TTL <= 0 {
+		p.TTL = time.Minute
+	}
+
+	if p.KeyPrefix == "" {
+		p.KeyPrefix = "tdb:qc:" + name + ":"
+	}
+
+	if p.MaxResultBytes <= 0 {
+		p.MaxResultBytes = 1 << 20
+	}
+
+	return p
+}
+
+type queryCacheCtxKey struct{}
+
+// WithCachedReads returns a context whose queries are served from the cache installed by [WithQueryCache] and cached
+// for ttl; a non-positive ttl uses [QueryCacheSettings.TTL]. Use [Cached] to cache a single query instead.
+func WithCachedReads(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, queryCacheCtxKey{}, ttl)
+}
+
+// Cached returns a GORM scope that serves the query from the cache installed by [WithQueryCache] and caches its
+// result for ttl; a non-positive ttl uses [QueryCacheSettings.TTL].
+//
+//	db.Scopes(tdb.Cached(time.Minute)).Where("code = ?", code).First(&country)
+func Cached(ttl time.Duration) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(queryCacheTTLKey, ttl)
+	}
+}
+
+// cachedValue is one column value of a cached row. Values are tagged by kind so that decoding restores the types
+// the driver returned.
+type cachedValue struct {
+	Kind  uint8
+	Int   int64
+	Uint  uint64
+	Float float64
+	Bytes []byte
+	Time  time.Time
+}
+
+const (
+	cachedNull uint8 = iota
+	cachedInt64
+	cachedUint64
+	cachedFloat32
+	cachedFloat64
+	cachedBool
+	cachedBytes
+	cachedString
+	cachedTime
+)
+
+// cachedResult is the encoded form of a query result.
+type cachedResult struct {
+	Columns []string
+	Rows    [][]cachedValue
+}
+
+// queryCache serves opted-in queries from Redis and invalidates a table's cached results whenever it is written.
+//
+// Every table has a generation counter in Redis that is part of the key of each cached result reading it; a write
+// increments the counter, so earlier results are no longer found and expire with their TTL.
+type queryCache struct {
+	redis    *RedisClient
+	settings QueryCacheSettings
+
+	// client is set once the owning client is built, so invalidations can wait for the commit of its transactions.
+	client *MysqlClient
+}
+
+// Name implements [gorm.Plugin].
+func (p *queryCache) Name() string {
+	return queryCachePluginName
+}
+
+// Initialize implements [gorm.Plugin]. Queries are served through GORM's own gorm:query, which runs on a
+// cachingConnPool for the queries that opted in; the replica router, when present, picks the pool first. Writes
+// are invalidated after the transaction GORM opens around each Create, Update, and Delete has committed.
+func (p *queryCache) Initialize(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Query().Before("gorm:query").After("tdb:resolve_query").
+			Register("tdb:cache_before_query", p.beforeQuery),
+		db.Callback().Query().After("gorm:query").Register("tdb:cache_after_query", p.afterQuery),
+		db.Callback().Create().After("gorm:commit_or_rollback_transaction").
+			Register("tdb:cache_after_create", p.afterWrite),
+		db.Callback().Update().After("gorm:commit_or_rollback_transaction").
+			Register("tdb:cache_after_update", p.afterWrite),
+		db.Callback().Delete().After("gorm:commit_or_rollback_transaction").
+			Register("tdb:cache_after_delete", p.afterWrite),
+		db.Callback().Raw().After("gorm:raw").Register("tdb:cache_after_raw", p.afterRaw),
+	)
+}
+
+// ttl returns the cache TTL requested for the statement and whether it may be cached at all. Reads inside a
+// transaction, locking reads, and reads forced to the primary with [WithPrimary] always go to the database.
+func (p *queryCache) ttl(db *gorm.DB) (time.Duration, bool) {
+	ttl, ok := time.Duration(0), false
+
+	if value, found := db.Get(queryCacheTTLKey); found {
+		ttl, ok = value.(time.Duration)
+	} else if db.Statement.Context != nil {
+		ttl, ok = db.Statement.Context.Value(queryCacheCtxKey{}).(time.Duration)
+	}
+
+	if !ok || inTransaction(db) || isPrimaryForced(db.Statement.Context) || !isReadStatement(db.Statement) {
+		return 0, false
+	}
+
+	if ttl <= 0 {
+		ttl = p.settings.TTL
+	}
+
+	return ttl, true
+}
+
+// beforeQuery routes a query that opted in through a cachingConnPool. Other queries are not touched.
+func (p *queryCache) beforeQuery(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+
+	ttl, ok := p.ttl(db)
+	if !ok {
+		return
+	}
+
+	db.Statement.ConnPool = &cachingConnPool{
+		ConnPool: db.Statement.ConnPool,
+
+		cache: p,
+		stmt:  db.Statement,
+		ttl:   ttl,
+	}
+}
+
+// afterQuery restores the connection pool replaced by beforeQuery.
+func (p *queryCache) afterQuery(db *gorm.DB) {
+	if pool, ok := db.Statement.ConnPool.(*cachingConnPool); ok {
+		db.Statement.ConnPool = pool.ConnPool
+	}
+}
+
+// cachingConnPool wraps the connection pool of an opted-in query while gorm:query runs. Its QueryContext serves the
+// query from the cache, or runs it and caches the rows, and returns rows that GORM scans as usual.
+type cachingConnPool struct {
+	gorm.ConnPool
+
+	cache *queryCache
+	stmt  *gorm.Statement
+	ttl   time.Duration
+}
+
+// QueryContext implements [gorm.ConnPool].
+func (p *cachingConnPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	// Without every table the query reads, its result could not be invalidated reliably.
+	tables := sqlTableNames(query)
+	if len(tables) == 0 || !isReadSQL(query) {
+		return p.ConnPool.QueryContext(ctx, query, args...)
+	}
+
+	metricTable := p.stmt.Table
+	if metricTable == "" {
+		metricTable = tables[0]
+	}
+
+	key, err := p.cache.resultKey(ctx, query, args, tables)
+	if err == nil {
+		var encoded []byte
+
+		encoded, err = p.cache.redis.client.Get(ctx, key).Bytes()
+		if err == nil {
+			result, decodeErr := decodeCachedResult(encoded)
+			if decodeErr == nil {
+				MysqlQueryCacheCounter.Inc(metricTable, queryCacheHit)
+
+				return replayCachedResult(ctx, result)
+			}
+
+			err = decodeErr
+		}
+	}
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		MysqlQueryCacheCounter.Inc(metricTable, queryCacheError)
+
+		tlog.W(ctx).Err(err).Msgf("MySQL query cache of %q could not be read.", metricTable)
+	} else {
+		MysqlQueryCacheCounter.Inc(metricTable, queryCacheMiss)
+	}
+
+	rows, err := p.ConnPool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := readCachedResult(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		encoded, err := encodeCachedResult(result)
+		if err == nil && len(encoded) <= p.cache.settings.MaxResultBytes {
+			err = p.cache.redis.client.Set(ctx, key, encoded, p.ttl).Err()
+			if err != nil {
+				tlog.W(ctx).Err(err).Msgf("MySQL query cache of %q could not be written.", metricTable)
+			}
+		}
+	}
+
+	return replayCachedResult(ctx, result)
+}
+
+// resultKey derives the cache key of a query from its normalized SQL, its bound values, and the current
+// generations of the tables it reads.
+func (p *queryCache) resultKey(ctx context.Context, rawSql string, vars []any, tables []string) (string, error) {
+	hash := sha256.New()
+
+	_, _ = io.WriteString(hash, normalizeCachedSQL(rawSql))
+
+	for _, v := range vars {
+		if valuer, ok := v.(driver.Valuer); ok {
+			value, err := valuer.Value()
+			if err != nil {
+				return "", err
+			}
+
+			v = value
+		}
+
+		_, _ = fmt.Fprintf(hash, "\x00%T:%v", v, v)
+	}
+
+	generationKeys := make([]string, len(tables))
+	for i, table := range tables {
+		generationKeys[i] = p.generationKey(table)
+	}
+
+	generations, err := p.redis.client.MGet(ctx, generationKeys...).Result()
+	if err != nil {
+		return "", err
+	}
+
+	for i, generation := range generations {
+		_, _ = fmt.Fprintf(hash, "\x00%s@%v", tables[i], generation)
+	}
+
+	return p.settings.KeyPrefix + "q:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (p *queryCache) generationKey(table string) string {
+	return p.settings.KeyPrefix + "gen:" + table
+}
+
+// afterWrite invalidates the table written by a successful Create, Update, or Delete.
+func (p *queryCache) afterWrite(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	table := db.Statement.Table
+	if table == "" && db.Statement.SQL.Len() > 0 {
+		table = sqlTableName(db.Statement.SQL.String())
+	}
+
+	p.invalidateAfterCommit(db, table)
+}
+
+// afterRaw invalidates the table written by a successful INSERT, REPLACE, UPDATE, or DELETE issued through Exec.
+func (p *queryCache) afterRaw(db *gorm.DB) {
+	if db.Error != nil || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	rawSql := db.Statement.SQL.String()
+
+	switch sqlOperation(rawSql) {
+	case "INSERT", "REPLACE", "UPDATE", "DELETE":
+		p.invalidateAfterCommit(db, sqlTableName(rawSql))
+	}
+}
+
+// invalidateAfterCommit invalidates table right away and, inside a transaction started by [MysqlClient.WithTx],
+// once more after the commit, so that a concurrent read that cached the old rows in between is not served. The
+// client does not observe the commit of sessions returned by [MysqlClient.Tx]; their callers invalidate with
+// [MysqlClient.InvalidateQueryCache] after committing.
+func (p *queryCache) invalidateAfterCommit(db *gorm.DB, table string) {
+	if table == "" || db.DryRun {
+		return
+	}
+
+	ctx := db.Statement.Context
+
+	p.invalidate(ctx, table)
+
+	if p.client == nil || !inTransaction(db) {
+		return
+	}
+
+	if ambient := p.client.ambientTx(ctx); ambient != nil {
+		ambient.onCommit(func() {
+			p.invalidate(context.WithoutCancel(ctx), table)
+		})
+	}
+}
+
+func (p *queryCache) invalidate(ctx context.Context, tables ...string) {
+	for _, table := range tables {
+		err := p.redis.client.Incr(ctx, p.generationKey(table)).Err()
+		if err != nil {
+			tlog.W(ctx).Err(err).Msgf("MySQL query cache of %q could not be invalidated.", table)
+		}
+	}
+}
+
+// queryCache returns the cache installed with [WithQueryCache], or nil.
+func (p *MysqlClient) queryCache() *queryCache {
+	plugin, ok := p.db.Config.Plugins[queryCachePluginName]
+	if !ok {
+		return nil
+	}
+
+	cache, _ := plugin.(*queryCache)
+
+	return cache
+}
+
+// InvalidateQueryCache drops the cached results reading any of tables, for writes that bypass the client such as
+// migrations or other services, and for writes made in a session from [MysqlClient.Tx], once it has committed. It
+// does nothing when the client has no query cache.
+func (p *MysqlClient) InvalidateQueryCache(ctx context.Context, tables ...string) {
+	if cache := p.queryCache(); cache != nil {
+		cache.invalidate(ctx, tables...)
+	}
+}
+
+var cachedSQLHint = regexp.MustCompile(`/\*\+.*?\*/`)
+
+// normalizeCachedSQL strips optimizer hints, such as the MAX_EXECUTION_TIME hint that varies with the remaining
+// deadline, and collapses whitespace so that equivalent queries share cache entries.
+func normalizeCachedSQL(rawSql string) string {
+	return strings.Join(strings.Fields(cachedSQLHint.ReplaceAllString(rawSql, " ")), " ")
+}
+
+// readCachedResult reads and closes rows, keeping the values as returned by the driver.
+func readCachedResult(rows *sql.Rows) (*cachedResult, error) {
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &cachedResult{
+		Columns: columns,
+	}
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+
+		row := make([]cachedValue, len(values))
+		for i, value := range values {
+			row[i] = newCachedValue(value)
+		}
+
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result, rows.Err()
+}
+
+func newCachedValue(value any) cachedValue {
+	switch v := value.(type) {
+	case int64:
+		return cachedValue{Kind: cachedInt64, Int: v}
+	case uint64:
+		return cachedValue{Kind: cachedUint64, Uint: v}
+	case float32:
+		return cachedValue{Kind: cachedFloat32, Float: float64(v)}
+	case float64:
+		return cachedValue{Kind: cachedFloat64, Float: v}
+	case bool:
+		if v {
+			return cachedValue{Kind: cachedBool, Int: 1}
+		}
+
+		return cachedValue{Kind: cachedBool}
+	case []byte:
+		return cachedValue{Kind: cachedBytes, Bytes: v}
+	case string:
+		return cachedValue{Kind: cachedString, Bytes: []byte(v)}
+	case time.Time:
+		return cachedValue{Kind: cachedTime, Time: v}
+	case nil:
+		return cachedValue{Kind: cachedNull}
+	default:
+		return cachedValue{Kind: cachedString, Bytes: fmt.Append(nil, v)}
+	}
+}
+
+func (p cachedValue) value() driver.Value {
+	switch p.Kind {
+	case cachedInt64:
+		return p.Int
+	case cachedUint64:
+		return p.Uint
+	case cachedFloat32:
+		return float32(p.Float)
+	case cachedFloat64:
+		return p.Float
+	case cachedBool:
+		return p.Int != 0
+	case cachedBytes:
+		return p.Bytes
+	case cachedString:
+		return string(p.Bytes)
+	case cachedTime:
+		return p.Time
+	default:
+		return nil
+	}
+}
+
+func encodeCachedResult(result *cachedResult) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeCachedResult(encoded []byte) (*cachedResult, error) {
+	result := &cachedResult{}
+
+	err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// replayCachedResult returns result as the rows of an in-memory driver, so that GORM scans it exactly as rows read
+// from the database.
+func replayCachedResult(ctx context.Context, result *cachedResult) (*sql.Rows, error) {
+	return cachedResultDB().QueryContext(context.WithValue(context.WithoutCancel(ctx), cachedResultCtxKey{}, result), "")
+}
+
+type cachedResultCtxKey struct{}
+
+// cachedResultDB is the [sql.DB] over the in-memory driver that replays cached results.
+var cachedResultDB = sync.OnceValue(func() *sql.DB {
+	return sql.OpenDB(cachedResultConnector{})
+})
+
+// cachedResultConnector, cachedResultConn, and cachedResultRows form a read-only driver whose queries return the
+// cachedResult carried by the query context.
+type cachedResultConnector struct{}
+
+func (cachedResultConnector) Connect(context.Context) (driver.Conn, error) {
+	return cachedResultConn{}, nil
+}
+
+func (p cachedResultConnector) Driver() driver.Driver {
+	return p
+}
+
+func (cachedResultConnector) Open(string) (driver.Conn, error) {
+	return cachedResultConn{}, nil
+}
+
+type cachedResultConn struct{}
+
+var errCachedResultConn = errors.New("mysql query cache replay supports queries only")
+
+func (cachedResultConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errCachedResultConn
+}
+
+func (cachedResultConn) Close() error {
+	return nil
+}
+
+func (cachedResultConn) Begin() (driver.Tx, error) {
+	return nil, errCachedResultConn
+}
+
+func (cachedResultConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	result, ok := ctx.Value(cachedResultCtxKey{}).(*cachedResult)
+	if !ok {
+		return nil, errCachedResultConn
+	}
+
+	return &cachedResultRows{result: result}, nil
+}
+
+type cachedResultRows struct {
+	result *cachedResult
+	next   int
+}
+
+func (p *cachedResultRows) Columns() []string {
+	return p.result.Columns
+}
+
+func (p *cachedResultRows) Close() error {
+	return nil
+}
+
+func (p *cachedResultRows) Next(dest []driver.Value) error {
+	if p.next >= len(p.result.Rows) {
+		return io.EOF
+	}
+
+	for i, value := range p.result.Rows[p.next] {
+		dest[i] = value.value()
+	}
+
+	p.next++
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package tdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"go.yaml.in/yaml/v2"
+)
+
+const (
+	defaultMysqlPort           = 3306
+	defaultMysqlCharset        = "utf8mb4"
+	defaultMysqlConnectTimeout = 5 * time.Second
+
+	// defaultMysqlEnvPrefix prefixes the environment variables read by [LoadMysqlConfigFromEnv].
+	defaultMysqlEnvPrefix = "MYSQL"
+)
+
+// MysqlConfig describes a MySQL connection and builds its DSN with [MysqlConfig.DSN]. Time values are always parsed
+// into [time.Time], and the location defaults to UTC, matching the UTC month boundaries of the sharding rules.
+//
+// Its yaml tags name the keys read by [LoadMysqlConfigFromYAML]; [LoadMysqlConfigFromEnv] reads the same keys,
+// upper-cased and prefixed, such as MYSQL_HOST or MYSQL_CONNECT_TIMEOUT. Durations use [time.ParseDuration] syntax.
+type MysqlConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+
+	// Charset defaults to utf8mb4. Collation defaults to the server's default collation of Charset.
+	Charset   string `yaml:"charset"`
+	Collation string `yaml:"collation"`
+
+	// ConnectTimeout bounds dialing and defaults to 5s. ReadTimeout and WriteTimeout bound network I/O and are
+	// disabled by default; prefer [WithStatementTimeout] for bounding statements.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	ReadTimeout    time.Duration `yaml:"read_timeout"`
+	WriteTimeout   time.Duration `yaml:"write_timeout"`
+
+	// TLSCAFile enables TLS verified against the PEM certificates in the file. TLSCertFile and TLSKeyFile add a client
+	// certificate and must be set together. TLSServerName overrides the host name verified in the server certificate.
+	TLSCAFile     string `yaml:"tls_ca_file"`
+	TLSCertFile   string `yaml:"tls_cert_file"`
+	TLSKeyFile    string `yaml:"tls_key_file"`
+	TLSServerName string `yaml:"tls_server_name"`
+
+	// InterpolateParams makes the driver interpolate placeholders client-side instead of preparing every statement
+	// with bound parameters, saving a round trip per statement.
+	InterpolateParams bool `yaml:"interpolate_params"`
+
+	// Location is the IANA name of the time zone DATETIME values are read and written in. The default is UTC, which
+	// also sets the session time_zone so that NOW() and friends agree with the client.
+	Location string `yaml:"location"`
+}
+
+// LoadMysqlConfigFromYAML parses a [MysqlConfig] from YAML and validates it.
+func LoadMysqlConfigFromYAML(data []byte) (*MysqlConfig, error) {
+	cfg := &MysqlConfig{}
+
+	err := yaml.UnmarshalStrict(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("parse mysql config: %w", err)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadMysqlConfigFromEnv reads a [MysqlConfig] from environment variables named after its yaml keys, upper-cased and
+// joined to prefix with an underscore, and validates it. An empty prefix defaults to MYSQL.
+func LoadMysqlConfigFromEnv(prefix string) (*MysqlConfig, error) {
+	if prefix == "" {
+		prefix = defaultMysqlEnvPrefix
+	}
+
+	cfg := &MysqlConfig{}
+
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	cfgType := cfgValue.Type()
+
+	for i := 0; i < cfgType.NumField(); i++ {
+		name := prefix + "_" + strings.ToUpper(cfgType.Field(i).Tag.Get("yaml"))
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		err := setMysqlConfigField(cfgValue.Field(i), value)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// setMysqlConfigField parses value into a string, int, bool, or duration field.
+func setMysqlConfigField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(number))
+	case field.Kind() == reflect.Bool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(enabled)
+	default:
+		field.SetString(value)
+	}
+
+	return nil
+}
+
+// Validate reports the first missing or inconsistent setting.
+func (p *MysqlConfig) Validate() error {
+	switch {
+	case p.Host == "":
+		return errors.New("mysql config: host is required")
+	case p.Port < 0 || p.Port > 65535:
+		return fmt.Errorf("mysql config: invalid port %d", p.Port)
+	case p.User == "":
+		return errors.New("mysql config: user is required")
+	case p.Database == "":
+		return errors.New("mysql config: database is required")
+	case p.ConnectTimeout < 0 || p.ReadTimeout < 0 || p.WriteTimeout < 0:
+		return errors.New("mysql config: timeouts must not be negative")
+	case (p.TLSCertFile == "") != (p.TLSKeyFile == ""):
+		return errors.New("mysql config: tls_cert_file and tls_key_file must be set together")
+	case p.TLSCertFile != "" && p.TLSCAFile == "":
+		return errors.New("mysql config: a client certificate requires tls_ca_file")
+	case p.TLSServerName != "" && p.TLSCAFile == "":
+		return errors.New("mysql config: tls_server_name requires tls_ca_file")
+	}
+
+	charset := p.Charset
+	if charset == "" {
+		charset = defaultMysqlCharset
+	}
+
+	if p.Collation != "" && !strings.HasPrefix(p.Collation, charset+"_") {
+		return fmt.Errorf("mysql config: collation %q does not belong to charset %q", p.Collation, charset)
+	}
+
+	_, err := p.location()
+	if err != nil {
+		return fmt.Errorf("mysql config: %w", err)
+	}
+
+	return nil
+}
+
+func (p *MysqlConfig) location() (*time.Location, error) {
+	if p.Location == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(p.Location)
+}
+
+// DSN validates the configuration and returns the DSN for [NewMysqlClientWithOptions]. With TLS enabled, it loads
+// the certificate files and registers them with the driver under a name derived from the file paths.
+func (p *MysqlConfig) DSN() (string, error) {
+	err := p.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	loc, err := p.location()
+	if err != nil {
+		return "", err
+	}
+
+	port := p.Port
+	if port == 0 {
+		port = defaultMysqlPort
+	}
+
+	charset := p.Charset
+	if charset == "" {
+		charset = defaultMysqlCharset
+	}
+
+	connectTimeout := p.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = defaultMysqlConnectTimeout
+	}
+
+	driverCfg := mysqldriver.NewConfig()
+
+	driverCfg.User = p.User
+	driverCfg.Passwd = p.Password
+	driverCfg.Net = "tcp"
+	driverCfg.Addr = net.JoinHostPort(p.Host, strconv.Itoa(port))
+	driverCfg.DBName = p.Database
+	driverCfg.Loc = loc
+	driverCfg.ParseTime = true
+	driverCfg.InterpolateParams = p.InterpolateParams
+	driverCfg.Timeout = connectTimeout
+	driverCfg.ReadTimeout = p.ReadTimeout
+	driverCfg.WriteTimeout = p.WriteTimeout
+
+	if loc == time.UTC {
+		driverCfg.Params = map[string]string{
+			"time_zone": "'+00:00'",
+		}
+	}
+
+	err = driverCfg.Apply(mysqldriver.Charset(charset, p.Collation))
+	if err != nil {
+		return "", fmt.Errorf("mysql config: %w", err)
+	}
+
+	if p.TLSCAFile != "" {
+		driverCfg.TLSConfig, err = p.registerTLS()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return driverCfg.FormatDSN(), nil
+}
+
+// registerTLS loads the certificate files and registers them with the driver, returning the registered name.
+func (p *MysqlConfig) registerTLS() (string, error) {
+	caPem, err := os.ReadFile(p.TLSCAFile)
+	if err != nil {
+		return "", fmt.Errorf("mysql config: read tls_ca_file: %w", err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caPem) {
+		return "", fmt.Errorf("mysql config: no certificates in tls_ca_file %q", p.TLSCAFile)
+	}
+
+	serverName := p.TLSServerName
+	if serverName == "" {
+		serverName = p.Host
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    rootCAs,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if p.TLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(p.TLSCertFile, p.TLSKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("mysql config: load client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join([]string{p.TLSCAFile, p.TLSCertFile, p.TLSKeyFile, serverName}, "\x00")))
+	name := "tdb-" + hex.EncodeToString(hash[:8])
+
+	err = mysqldriver.RegisterTLSConfig(name, tlsConfig)
+	if err != nil {
+		return "", fmt.Errorf("mysql config: register tls config: %w", err)
+	}
+
+	return name, nil
+}
+
+// NewMysqlClientFromConfig opens a client for the DSN built from cfg, configured by opts.
+func NewMysqlClientFromConfig(ctx context.Context, cfg *MysqlConfig, opts ...MysqlOption) (*MysqlClient, error) {
+	dsn, err := cfg.DSN()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMysqlClientWithOptions(ctx, dsn, opts...)
+}
@@ -0,0 +1,146 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// explainTimeout bounds a single EXPLAIN so plan capture cannot hold a connection for long.
+	explainTimeout = 5 * time.Second
+)
+
+// explainTarget is a slow SELECT captured for plan analysis.
+type explainTarget struct {
+	pool *sql.DB
+	sql  string
+	vars []interface{}
+}
+
+// explainSlot carries the explain target of the current statement from the metric callbacks to [dbLogger.Trace].
+type explainSlot struct {
+	target atomic.Pointer[explainTarget]
+}
+
+type explainCtxKey struct{}
+
+// newExplainCaptureHook returns a callback that records slow SELECT statements for EXPLAIN.
+// Statements running on a transaction connection are explained on fallbackPool instead, so the user's
+// transaction is never touched.
+func newExplainCaptureHook(fallbackPool *sql.DB) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		dbLog, ok := db.Logger.(*dbLogger)
+		if !ok || dbLog.slowLog == nil || dbLog.slowLog.explainBudget.Load() <= 0 {
+			return
+		}
+
+		if db.DryRun || db.Error != nil || !isSelectSQL(db.Statement.SQL.String()) {
+			return
+		}
+
+		srcStartTime, ok := db.Get("metric_start_time")
+		if !ok {
+			return
+		}
+
+		startTime, ok := srcStartTime.(time.Time)
+		if !ok || !dbLog.slowLog.isSlow(time.Since(startTime)) {
+			return
+		}
+
+		pool, ok := db.Statement.ConnPool.(*sql.DB)
+		if !ok {
+			pool = fallbackPool
+		}
+
+		if pool == nil {
+			return
+		}
+
+		slot, ok := db.Statement.Context.Value(explainCtxKey{}).(*explainSlot)
+		if !ok {
+			slot = &explainSlot{}
+
+			db.Statement.Context = context.WithValue(db.Statement.Context, explainCtxKey{}, slot)
+		}
+
+		slot.target.Store(&explainTarget{
+			pool: pool,
+			sql:  db.Statement.SQL.String(),
+			vars: append([]interface{}(nil), db.Statement.Vars...),
+		})
+	}
+}
+
+// takeExplainTarget returns and clears the explain target recorded for the statement being traced.
+func takeExplainTarget(ctx context.Context) *explainTarget {
+	slot, ok := ctx.Value(explainCtxKey{}).(*explainSlot)
+	if !ok {
+		return nil
+	}
+
+	return slot.target.Swap(nil)
+}
+
+// isSelectSQL reports whether rawSql is a SELECT statement.
+func isSelectSQL(rawSql string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(rawSql)), "select")
+}
+
+// allowExplain consumes one entry of the per-minute EXPLAIN budget.
+func (p *slowQueryLog) allowExplain() bool {
+	budget := p.explainBudget.Load()
+	if budget <= 0 {
+		return false
+	}
+
+	allowed, _ := p.explainRate.take(budget, time.Minute)
+
+	return allowed
+}
+
+// explain runs EXPLAIN FORMAT=JSON for target on its own pooled connection and returns the plan.
+func (p *explainTarget) explain(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+	defer cancel()
+
+	var plan string
+
+	err := p.pool.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+p.sql, p.vars...).Scan(&plan)
+	if err != nil {
+		return "", err
+	}
+
+	return plan, nil
+}
+
+// logWithPlan captures the plan of target and emits the slow-query entry with the plan attached.
+// It runs in its own goroutine so the statement's caller is not delayed by the EXPLAIN round trip.
+func (p *slowQueryLog) logWithPlan(ctx context.Context, target *explainTarget, rawSql string, rowsAffected int64,
+	latency time.Duration, caller string) {
+	event := p.event(ctx).
+		Detailf("caller:%s", caller).
+		Detailf("rows:%d", rowsAffected)
+
+	plan, err := target.explain(ctx)
+	if err != nil {
+		event = event.Detailf("explain_error:%s", err)
+	} else {
+		event = event.Detailf("plan:%s", plan)
+	}
+
+	event.Msgf("Detected slow SQL statement: sql=%s latency=%s", rawSql, latency)
+}
+
+// SetSlowExplainBudget enables automatic EXPLAIN FORMAT=JSON capture for slow SELECT statements, running at most
+// perMinute EXPLAINs per minute. The plan is attached to the slow-query log entry, which is then emitted
+// asynchronously. EXPLAIN runs on a separate pooled connection and never inside the caller's transaction.
+// A non-positive value disables capture, which is the default.
+func (p *MysqlClient) SetSlowExplainBudget(perMinute int) {
+	p.slowQueryLog().explainBudget.Store(int64(perMinute))
+}
@@ -0,0 +1,97 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// drainPollInterval is how often [MysqlClient.Close] checks whether in-flight statements have finished.
+	drainPollInterval = 10 * time.Millisecond
+)
+
+// ErrClientClosed is returned by sessions obtained from a [MysqlClient] after [MysqlClient.Close] has been called.
+var ErrClientClosed = errors.New("mysql client is closed")
+
+// closedDB returns a session that fails every statement with [ErrClientClosed] without touching the pool.
+func (p *MysqlClient) closedDB(ctx context.Context) *gorm.DB {
+	db := p.db.WithContext(ctx)
+
+	db.Error = ErrClientClosed
+
+	return db
+}
+
+// pools returns the primary connection pool followed by every replica pool.
+func (p *MysqlClient) pools() []*sql.DB {
+	pools := make([]*sql.DB, 0, 1)
+
+	sqlDB, err := p.db.DB()
+	if err == nil {
+		pools = append(pools, sqlDB)
+	}
+
+	if p.resolver != nil {
+		pools = append(pools, p.resolver.pools()...)
+	}
+
+	return pools
+}
+
+// drain waits until no connection of any pool is in use, or until ctx is done.
+func (p *MysqlClient) drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inUse := 0
+		for _, pool := range p.pools() {
+			inUse += pool.Stats().InUse
+		}
+
+		if inUse == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("drain mysql connections: %d still in use: %w", inUse, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close rejects new sessions with [ErrClientClosed], waits for in-flight statements and transactions to release
+// their connections until ctx is done, stops the pool metrics reporter, and closes the primary and replica
+// connection pools. The pools are closed even when draining times out. Close may be called safely more than once.
+func (p *MysqlClient) Close(ctx context.Context) error {
+	var err error
+
+	p.closeOnce.Do(func() {
+		p.closed.Store(true)
+
+		err = p.drain(ctx)
+
+		close(p.stop)
+
+		p.wg.Wait()
+
+		sqlDB, dbErr := p.db.DB()
+		if dbErr != nil {
+			err = errors.Join(err, dbErr)
+		} else {
+			err = errors.Join(err, sqlDB.Close())
+		}
+
+		if p.resolver != nil {
+			err = errors.Join(err, p.resolver.close())
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,250 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/choveylee/tlog"
+)
+
+const (
+	// lockCheckInterval is how often a held [MysqlLock] verifies with IS_USED_LOCK that it still owns the lock.
+	lockCheckInterval = 5 * time.Second
+
+	// lockCheckAttempts is how many consecutive IS_USED_LOCK checks may fail, for example on a brief pool error,
+	// before ownership counts as unverifiable and the lock as lost.
+	lockCheckAttempts = 3
+
+	// lockReleaseTimeout bounds RELEASE_LOCK after the lock was lost or its context was canceled.
+	lockReleaseTimeout = 5 * time.Second
+
+	// maxLockNameLength is the longest lock name MySQL accepts.
+	maxLockNameLength = 64
+)
+
+// ErrLockNotAcquired is returned by [MysqlClient.Lock] when another session holds the lock for the whole timeout.
+var ErrLockNotAcquired = errors.New("mysql lock not acquired")
+
+// MysqlLock is a named MySQL advisory lock acquired with GET_LOCK. It pins one connection of the primary pool,
+// since MySQL releases the lock when that session ends. Call [MysqlLock.Unlock] when done.
+type MysqlLock struct {
+	name string
+
+	conn         *sql.Conn
+	connectionId int64
+
+	lost     chan struct{}
+	lostOnce sync.Once
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+// Lock acquires the advisory lock name, waiting up to timeout for another holder to release it; a negative timeout
+// waits indefinitely. It returns [ErrLockNotAcquired] when the wait times out.
+//
+// The lock is held until [MysqlLock.Unlock] is called or ctx is done. While held, it is checked periodically with
+// IS_USED_LOCK from another connection; if the pinned session was lost, for example after a network failure or a
+// server-side kill, or several checks in a row fail, [MysqlLock.Lost] is closed and work guarded by the lock should
+// stop. A lost lock is released and its connection returned to the pool without waiting for Unlock.
+func (p *MysqlClient) Lock(ctx context.Context, name string, timeout time.Duration) (*MysqlLock, error) {
+	if p.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	if name == "" || len(name) > maxLockNameLength {
+		return nil, fmt.Errorf("invalid mysql lock name %q", name)
+	}
+
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pin mysql lock connection: %w", err)
+	}
+
+	timeoutSeconds := int64(-1)
+	if timeout >= 0 {
+		timeoutSeconds = int64(math.Ceil(timeout.Seconds()))
+	}
+
+	var (
+		acquired     sql.NullInt64
+		connectionId int64
+	)
+
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?), CONNECTION_ID()", name, timeoutSeconds).
+		Scan(&acquired, &connectionId)
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("get mysql lock %q: %w", name, err)
+	}
+
+	if !acquired.Valid {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("get mysql lock %q: server returned NULL", name)
+	}
+
+	if acquired.Int64 != 1 {
+		_ = conn.Close()
+
+		return nil, ErrLockNotAcquired
+	}
+
+	lock := &MysqlLock{
+		name: name,
+
+		conn:         conn,
+		connectionId: connectionId,
+
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+
+	lock.wg.Add(1)
+
+	go lock.watch(ctx, sqlDB)
+
+	return lock, nil
+}
+
+// Name returns the lock name.
+func (p *MysqlLock) Name() string {
+	return p.name
+}
+
+// Lost returns a channel that is closed when the lock is no longer held without [MysqlLock.Unlock] having been
+// called: the pinned session was lost, ownership could not be verified, or the lock context is done.
+func (p *MysqlLock) Lost() <-chan struct{} {
+	return p.lost
+}
+
+// Unlock releases the lock with RELEASE_LOCK and returns the pinned connection to the pool. It is safe to call
+// more than once; after the lock was lost, it reports the outcome of the release that already happened then.
+func (p *MysqlLock) Unlock(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+
+	p.wg.Wait()
+
+	return p.release(ctx)
+}
+
+// watch verifies ownership every lockCheckInterval and releases the lock when ctx is done.
+func (p *MysqlLock) watch(ctx context.Context, pool *sql.DB) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(lockCheckInterval)
+	defer ticker.Stop()
+
+	failedChecks := 0
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ctx.Done():
+			p.markLost()
+			p.releaseLost(ctx)
+
+			return
+		case <-ticker.C:
+			held, err := p.held(ctx, pool)
+			if err == nil && held {
+				failedChecks = 0
+
+				continue
+			}
+
+			if err != nil {
+				failedChecks++
+
+				if failedChecks < lockCheckAttempts {
+					tlog.W(ctx).Err(err).Msgf("MySQL lock %q could not be checked (attempt %d of %d).",
+						p.name, failedChecks, lockCheckAttempts)
+
+					continue
+				}
+			}
+
+			event := tlog.E(ctx)
+			if err != nil {
+				event = event.Err(err)
+			}
+
+			event.Msgf("MySQL lock %q held by connection %d was lost.", p.name, p.connectionId)
+
+			p.markLost()
+			p.releaseLost(ctx)
+
+			return
+		}
+	}
+}
+
+// releaseLost releases a lost lock with a context of its own, since ctx may be done, so that the pinned connection
+// returns to the pool even if the caller never calls Unlock.
+func (p *MysqlLock) releaseLost(ctx context.Context) {
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockReleaseTimeout)
+	defer cancel()
+
+	err := p.release(releaseCtx)
+	if err != nil {
+		tlog.W(ctx).Err(err).Msgf("MySQL lock %q could not be released after it was lost.", p.name)
+	}
+}
+
+// held reports whether the pinned session still owns the lock, checked from another pooled connection so that
+// a dead pinned connection cannot vouch for itself.
+func (p *MysqlLock) held(ctx context.Context, pool *sql.DB) (bool, error) {
+	checkCtx, cancel := context.WithTimeout(ctx, lockCheckInterval)
+	defer cancel()
+
+	var owner sql.NullInt64
+
+	err := pool.QueryRowContext(checkCtx, "SELECT IS_USED_LOCK(?)", p.name).Scan(&owner)
+	if err != nil {
+		return false, err
+	}
+
+	return owner.Valid && owner.Int64 == p.connectionId, nil
+}
+
+func (p *MysqlLock) markLost() {
+	p.lostOnce.Do(func() {
+		close(p.lost)
+	})
+}
+
+// release runs RELEASE_LOCK on the pinned connection once and closes it.
+func (p *MysqlLock) release(ctx context.Context) error {
+	p.releaseOnce.Do(func() {
+		var released sql.NullInt64
+
+		err := p.conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", p.name).Scan(&released)
+		if err != nil {
+			err = fmt.Errorf("release mysql lock %q: %w", p.name, err)
+		} else if !released.Valid || released.Int64 != 1 {
+			err = fmt.Errorf("release mysql lock %q: lock was not held", p.name)
+		}
+
+		p.releaseErr = errors.Join(err, p.conn.Close())
+	})
+
+	return p.releaseErr
+}
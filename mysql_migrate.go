@@ -0,0 +1,616 @@
+package tdb
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/choveylee/tlog"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMigrationTable       = "schema_migrations"
+	defaultMigrationLockTimeout = time.Minute
+
+	mysqlErrNoSuchTable = 1146
+)
+
+var (
+	migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+	migrationTablePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,48}$`)
+
+	// compoundStatementPattern matches the fingerprint of a stored program or trigger with a BEGIN ... END body.
+	compoundStatementPattern = regexp.MustCompile(`(?i)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:DEFINER\s*=\s*\S+\s+)?` +
+		`(?:AGGREGATE\s+)?(?:TRIGGER|PROCEDURE|FUNCTION|EVENT)\b.*\bBEGIN\b`)
+)
+
+// ErrMigrationChecksum is returned by [Migrator] when an applied migration no longer matches its source.
+var ErrMigrationChecksum = errors.New("applied migration checksum mismatch")
+
+// Migration is a schema migration implemented in Go. Up and Down run inside a transaction obtained from
+// [MysqlClient.WithTx]; Down may be nil for irreversible migrations.
+type Migration struct {
+	Version int64
+	Name    string
+
+	// Checksum identifies what Up does, such as a revision number or a hash of the SQL it runs, since the code of a
+	// function cannot be hashed. Change it whenever Up changes, and [Migrator] refuses to run while an applied
+	// migration's Checksum differs, as it does for an edited SQL file. Without it, only Name is checked.
+	Checksum string
+
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+// MigrateOptions controls a [Migrator.Up] or [Migrator.Down] run. A nil value migrates all the way.
+type MigrateOptions struct {
+	// TargetVersion stops [Migrator.Up] after this version, and makes [Migrator.Down] roll back only versions
+	// newer than it. Zero means the latest version for Up and every version for Down.
+	TargetVersion int64
+
+	// DryRun reports the migrations that would run without executing them or taking the migration lock.
+	DryRun bool
+}
+
+type migratorOptions struct {
+	table       string
+	lockTimeout time.Duration
+	funcs       []Migration
+}
+
+// MigratorOption configures a [Migrator].
+type MigratorOption func(*migratorOptions)
+
+// WithMigrationTable sets the history table, which defaults to schema_migrations.
+func WithMigrationTable(table string) MigratorOption {
+	return func(opts *migratorOptions) {
+		opts.table = table
+	}
+}
+
+// WithMigrationLockTimeout sets how long a runner waits for another runner to finish. The default is one minute.
+func WithMigrationLockTimeout(timeout time.Duration) MigratorOption {
+	return func(opts *migratorOptions) {
+		opts.lockTimeout = timeout
+	}
+}
+
+// WithMigrationFuncs adds migrations implemented in Go next to the SQL files.
+func WithMigrationFuncs(migrations ...Migration) MigratorOption {
+	return func(opts *migratorOptions) {
+		opts.funcs = append(opts.funcs, migrations...)
+	}
+}
+
+// migration is a loaded migration with its checksum.
+type migration struct {
+	version  int64
+	name     string
+	checksum string
+
+	up   func(tx *gorm.DB) error
+	down func(tx *gorm.DB) error
+}
+
+// Migrator applies numbered schema migrations to the primary of a [MysqlClient] and records them with checksums
+// in a history table. Concurrent runners, for example one per pod, are serialized with [MysqlClient.Lock].
+//
+// MySQL commits DDL statements implicitly, so a failing migration that mixes DDL with other statements can be
+// left partially applied; keep one DDL change per migration.
+type Migrator struct {
+	client *MysqlClient
+
+	migrations []*migration
+
+	table       string
+	lockTimeout time.Duration
+}
+
+// NewMigrator loads migrations from the root directory of fsys, such as an [embed.FS] narrowed with [fs.Sub].
+// SQL files are named VERSION_NAME.up.sql and VERSION_NAME.down.sql, for example 0001_create_orders.up.sql,
+// and may contain several statements separated by semicolons, or by another delimiter set with a DELIMITER line as
+// in the mysql client; triggers and stored programs with a BEGIN ... END body need one. Versions must be unique
+// across SQL files and migrations added with [WithMigrationFuncs]. A nil fsys loads Go migrations only.
+func NewMigrator(client *MysqlClient, fsys fs.FS, opts ...MigratorOption) (*Migrator, error) {
+	options := &migratorOptions{
+		table:       defaultMigrationTable,
+		lockTimeout: defaultMigrationLockTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if !migrationTablePattern.MatchString(options.table) {
+		return nil, fmt.Errorf("invalid migration table %q", options.table)
+	}
+
+	migrations := make(map[int64]*migration)
+
+	if fsys != nil {
+		err := loadSQLMigrations(fsys, migrations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, funcMigration := range options.funcs {
+		if funcMigration.Version <= 0 || funcMigration.Up == nil {
+			return nil, fmt.Errorf("invalid go migration %d %q", funcMigration.Version, funcMigration.Name)
+		}
+
+		if _, ok := migrations[funcMigration.Version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d", funcMigration.Version)
+		}
+
+		source := "go:" + funcMigration.Name
+		if funcMigration.Checksum != "" {
+			source += "\x00" + funcMigration.Checksum
+		}
+
+		checksum := sha256.Sum256([]byte(source))
+
+		migrations[funcMigration.Version] = &migration{
+			version:  funcMigration.Version,
+			name:     funcMigration.Name,
+			checksum: hex.EncodeToString(checksum[:]),
+
+			up:   funcMigration.Up,
+			down: funcMigration.Down,
+		}
+	}
+
+	migrator := &Migrator{
+		client: client,
+
+		migrations: make([]*migration, 0, len(migrations)),
+
+		table:       options.table,
+		lockTimeout: options.lockTimeout,
+	}
+
+	for _, m := range migrations {
+		migrator.migrations = append(migrator.migrations, m)
+	}
+
+	slices.SortFunc(migrator.migrations, func(a, b *migration) int {
+		return cmp.Compare(a.version, b.version)
+	})
+
+	return migrator, nil
+}
+
+// loadSQLMigrations reads up and down SQL files from the root of fsys into migrations.
+func loadSQLMigrations(fsys fs.FS, migrations map[int64]*migration) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("read migrations: %w", err)
+	}
+
+	downSQL := make(map[int64][]string)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version <= 0 {
+			return fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return fmt.Errorf("read migration %q: %w", entry.Name(), err)
+		}
+
+		statements, err := splitSQLStatements(string(content))
+		if err != nil {
+			return fmt.Errorf("parse migration %q: %w", entry.Name(), err)
+		}
+
+		if matches[3] == "down" {
+			if _, ok := downSQL[version]; ok {
+				return fmt.Errorf("duplicate down migration version %d", version)
+			}
+
+			downSQL[version] = statements
+
+			continue
+		}
+
+		if _, ok := migrations[version]; ok {
+			return fmt.Errorf("duplicate migration version %d", version)
+		}
+
+		checksum := sha256.Sum256(content)
+
+		migrations[version] = &migration{
+			version:  version,
+			name:     matches[2],
+			checksum: hex.EncodeToString(checksum[:]),
+
+			up: execSQLMigration(statements),
+		}
+	}
+
+	for version, statements := range downSQL {
+		m, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("down migration %d has no up migration", version)
+		}
+
+		m.down = execSQLMigration(statements)
+	}
+
+	return nil
+}
+
+// execSQLMigration returns a migration step that executes statements in order.
+func execSQLMigration(statements []string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			err := tx.Exec(statement).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// splitSQLStatements splits content into statements the way the mysql client does: on the delimiter, a semicolon
+// unless a DELIMITER line sets another, outside quoted strings, identifiers, and comments. Plain comments are dropped,
+// while executable comments (/*! ... */) and optimizer hints (/*+ ... */) are kept verbatim. A trigger or stored
+// program with a BEGIN ... END body under the semicolon delimiter is rejected, since its body would be split apart.
+func splitSQLStatements(content string) ([]string, error) {
+	statements := make([]string, 0)
+
+	var (
+		current strings.Builder
+
+		delimiter = ";"
+
+		quote byte
+
+		lineStart    = true
+		lineComment  bool
+		blockComment bool
+		keptComment  bool
+	)
+
+	flush := func() error {
+		statement := strings.TrimSpace(current.String())
+
+		current.Reset()
+
+		if statement == "" {
+			return nil
+		}
+
+		if delimiter == ";" && compoundStatementPattern.MatchString(fingerprintSQL(statement)) {
+			return fmt.Errorf("statement %.60q has a BEGIN ... END body and needs a DELIMITER line", statement)
+		}
+
+		statements = append(statements, statement)
+
+		return nil
+	}
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		switch {
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+				lineStart = true
+				current.WriteByte(c)
+			}
+
+			continue
+		case blockComment:
+			if c == '*' && i+1 < len(content) && content[i+1] == '/' {
+				blockComment = false
+				i++
+
+				if keptComment {
+					current.WriteString("*/")
+				}
+			} else if keptComment {
+				current.WriteByte(c)
+			}
+
+			continue
+		case quote != 0:
+			current.WriteByte(c)
+
+			if c == '\\' && quote != '`' && i+1 < len(content) {
+				i++
+				current.WriteByte(content[i])
+			} else if c == quote {
+				quote = 0
+			}
+
+			continue
+		}
+
+		if lineStart {
+			lineStart = false
+
+			lineEnd := strings.IndexByte(content[i:], '\n')
+			if lineEnd < 0 {
+				lineEnd = len(content) - i
+			}
+
+			fields := strings.Fields(content[i : i+lineEnd])
+			if len(fields) > 0 && strings.EqualFold(fields[0], "DELIMITER") {
+				if len(fields) != 2 {
+					return nil, fmt.Errorf("invalid DELIMITER line %q", strings.TrimSpace(content[i:i+lineEnd]))
+				}
+
+				if strings.TrimSpace(current.String()) != "" {
+					return nil, fmt.Errorf("statement before DELIMITER %s is not terminated by %s", fields[1], delimiter)
+				}
+
+				delimiter = fields[1]
+
+				// Resume at the line break, which starts the next line.
+				i += lineEnd - 1
+
+				continue
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(content[i:], delimiter):
+			err := flush()
+			if err != nil {
+				return nil, err
+			}
+
+			i += len(delimiter) - 1
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			current.WriteByte(c)
+		case c == '#' || (c == '-' && strings.HasPrefix(content[i:], "-- ")):
+			lineComment = true
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			blockComment = true
+			keptComment = i+2 < len(content) && (content[i+2] == '!' || content[i+2] == '+')
+
+			if keptComment {
+				current.WriteString("/*")
+			}
+
+			i++
+		case c == '\n':
+			lineStart = true
+			current.WriteByte(c)
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return statements, nil
+}
+
+// Up applies pending migrations in version order, up to and including the target version of opts, and returns the
+// versions applied or, in a dry run, the versions that would be applied. It fails with [ErrMigrationChecksum]
+// before running anything when an applied migration has changed.
+func (p *Migrator) Up(ctx context.Context, opts *MigrateOptions) ([]int64, error) {
+	options := MigrateOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	return p.run(ctx, options, func(applied map[int64]string) ([]*migration, error) {
+		pending := make([]*migration, 0)
+
+		for _, m := range p.migrations {
+			if options.TargetVersion > 0 && m.version > options.TargetVersion {
+				break
+			}
+
+			if _, ok := applied[m.version]; !ok {
+				pending = append(pending, m)
+			}
+		}
+
+		return pending, nil
+	}, p.applyUp)
+}
+
+// Down rolls back applied migrations newer than the target version of opts, newest first, and returns the
+// versions rolled back or, in a dry run, the versions that would be rolled back.
+func (p *Migrator) Down(ctx context.Context, opts *MigrateOptions) ([]int64, error) {
+	options := MigrateOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	return p.run(ctx, options, func(applied map[int64]string) ([]*migration, error) {
+		pending := make([]*migration, 0)
+
+		for _, m := range slices.Backward(p.migrations) {
+			if m.version <= options.TargetVersion {
+				break
+			}
+
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+
+			if m.down == nil {
+				return nil, fmt.Errorf("migration %d %s has no down step", m.version, m.name)
+			}
+
+			pending = append(pending, m)
+		}
+
+		return pending, nil
+	}, p.applyDown)
+}
+
+// run serializes runners, verifies checksums, selects the steps to execute with plan, and applies them one by one.
+func (p *Migrator) run(ctx context.Context, options MigrateOptions,
+	plan func(applied map[int64]string) ([]*migration, error),
+	apply func(ctx context.Context, m *migration) error) ([]int64, error) {
+	// DDL such as ALTER TABLE may run far longer than the default statement timeout; abandoning it halfway helps no one.
+	ctx = withoutStatementTimeout(ctx)
+
+	var lostLock <-chan struct{}
+
+	if !options.DryRun {
+		lock, err := p.client.Lock(ctx, "tdb_migrate_"+p.table, p.lockTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("acquire migration lock: %w", err)
+		}
+
+		defer func() {
+			_ = lock.Unlock(context.WithoutCancel(ctx))
+		}()
+
+		lostLock = lock.Lost()
+
+		err = p.client.DB(ctx, ReleaseMode).Exec("CREATE TABLE IF NOT EXISTS `" + p.table + "` (" +
+			"`version` BIGINT NOT NULL PRIMARY KEY, " +
+			"`name` VARCHAR(255) NOT NULL, " +
+			"`checksum` CHAR(64) NOT NULL, " +
+			"`applied_at` DATETIME(6) NOT NULL)").Error
+		if err != nil {
+			return nil, fmt.Errorf("create migration table: %w", err)
+		}
+	}
+
+	applied, err := p.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.verify(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := plan(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int64, 0, len(pending))
+
+	for _, m := range pending {
+		if options.DryRun {
+			tlog.I(ctx).Msgf("MySQL migration %d %s would run (dry run).", m.version, m.name)
+
+			versions = append(versions, m.version)
+
+			continue
+		}
+
+		select {
+		case <-lostLock:
+			return versions, errors.New("migration lock lost")
+		default:
+		}
+
+		err = apply(ctx, m)
+		if err != nil {
+			return versions, fmt.Errorf("migration %d %s: %w", m.version, m.name, err)
+		}
+
+		tlog.I(ctx).Msgf("MySQL migration %d %s completed.", m.version, m.name)
+
+		versions = append(versions, m.version)
+	}
+
+	return versions, nil
+}
+
+// applied returns the checksum of every applied version. A missing history table means nothing was applied.
+func (p *Migrator) applied(ctx context.Context) (map[int64]string, error) {
+	rows := make([]struct {
+		Version  int64
+		Checksum string
+	}, 0)
+
+	err := p.client.DB(WithPrimary(ctx), ReleaseMode).
+		Raw("SELECT `version`, `checksum` FROM `" + p.table + "`").
+		Scan(&rows).Error
+	if err != nil {
+		var mysqlErr *mysqldriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrNoSuchTable {
+			return map[int64]string{}, nil
+		}
+
+		return nil, fmt.Errorf("read migration history: %w", err)
+	}
+
+	applied := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.Checksum
+	}
+
+	return applied, nil
+}
+
+// verify fails with [ErrMigrationChecksum] when an applied migration known to the source has a different checksum.
+func (p *Migrator) verify(applied map[int64]string) error {
+	for _, m := range p.migrations {
+		checksum, ok := applied[m.version]
+		if ok && checksum != m.checksum {
+			return fmt.Errorf("%w: version %d %s", ErrMigrationChecksum, m.version, m.name)
+		}
+	}
+
+	return nil
+}
+
+// applyUp runs the up step of m and records it in the history table within one transaction.
+func (p *Migrator) applyUp(ctx context.Context, m *migration) error {
+	return p.client.WithTx(ctx, ReleaseMode, func(tx *gorm.DB) error {
+		err := m.up(tx)
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("INSERT INTO `"+p.table+"` (`version`, `name`, `checksum`, `applied_at`) VALUES (?, ?, ?, ?)",
+			m.version, m.name, m.checksum, time.Now().UTC()).Error
+	})
+}
+
+// applyDown runs the down step of m and removes it from the history table within one transaction.
+func (p *Migrator) applyDown(ctx context.Context, m *migration) error {
+	return p.client.WithTx(ctx, ReleaseMode, func(tx *gorm.DB) error {
+		err := m.down(tx)
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("DELETE FROM `"+p.table+"` WHERE `version` = ?", m.version).Error
+	})
+}
@@ -0,0 +1,160 @@
+package tdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/gorm"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "semicolons",
+			content: "CREATE TABLE a (id INT);\n\nCREATE TABLE b (id INT);;\n",
+			want:    []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:    "quoted semicolons",
+			content: "INSERT INTO a VALUES ('x;y', \"it\\\";s\");\nALTER TABLE `a;b` ADD c INT",
+			want:    []string{"INSERT INTO a VALUES ('x;y', \"it\\\";s\")", "ALTER TABLE `a;b` ADD c INT"},
+		},
+		{
+			name:    "plain comments",
+			content: "-- create a\nCREATE TABLE a (id INT); # done\n/* b; c */ DROP TABLE b;",
+			want:    []string{"CREATE TABLE a (id INT)", "DROP TABLE b"},
+		},
+		{
+			name:    "executable comments",
+			content: "/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n/*!40014 SET x=1; */;",
+			want:    []string{"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */", "/*!40014 SET x=1; */"},
+		},
+		{
+			name:    "optimizer hints",
+			content: "UPDATE /*+ MAX_EXECUTION_TIME(1000) */ a SET b = 1;",
+			want:    []string{"UPDATE /*+ MAX_EXECUTION_TIME(1000) */ a SET b = 1"},
+		},
+		{
+			name: "delimiter",
+			content: "DROP TRIGGER IF EXISTS t;\n" +
+				"DELIMITER $$\n" +
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW\nBEGIN\n  SET NEW.b = 1;\n  SET NEW.c = ';';\nEND$$\n" +
+				"delimiter ;\n" +
+				"CREATE TABLE b (id INT);",
+			want: []string{
+				"DROP TRIGGER IF EXISTS t",
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW\nBEGIN\n  SET NEW.b = 1;\n  SET NEW.c = ';';\nEND",
+				"CREATE TABLE b (id INT)",
+			},
+		},
+		{
+			name:    "trigger without a body",
+			content: "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.b = 1;",
+			want:    []string{"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.b = 1"},
+		},
+		{
+			name:    "column named begin",
+			content: "CREATE TABLE event (`begin` INT);",
+			want:    []string{"CREATE TABLE event (`begin` INT)"},
+		},
+		{
+			name:    "procedure without delimiter",
+			content: "CREATE DEFINER='app'@'%' PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND;",
+			wantErr: "needs a DELIMITER line",
+		},
+		{
+			name:    "unterminated statement before delimiter",
+			content: "CREATE TABLE a (id INT)\nDELIMITER $$\n",
+			wantErr: "is not terminated",
+		},
+		{
+			name:    "delimiter without argument",
+			content: "DELIMITER\n",
+			wantErr: "invalid DELIMITER line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitSQLStatements(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitSQLStatements() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMigratorRejectsCompoundStatement(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_trigger.up.sql": {Data: []byte("CREATE TRIGGER t AFTER INSERT ON a FOR EACH ROW BEGIN SET @x = 1; END;")},
+	}
+
+	_, err := NewMigrator(nil, fsys)
+	if err == nil || !strings.Contains(err.Error(), "0001_trigger.up.sql") {
+		t.Errorf("NewMigrator() error = %v, want an error naming the file", err)
+	}
+}
+
+func TestGoMigrationChecksum(t *testing.T) {
+	up := func(tx *gorm.DB) error {
+		return nil
+	}
+
+	checksumOf := func(t *testing.T, migration Migration) string {
+		t.Helper()
+
+		migrator, err := NewMigrator(nil, nil, WithMigrationFuncs(migration))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return migrator.migrations[0].checksum
+	}
+
+	base := checksumOf(t, Migration{Version: 1, Name: "backfill", Up: up})
+
+	tests := []struct {
+		name      string
+		migration Migration
+		wantSame  bool
+	}{
+		{name: "same name", migration: Migration{Version: 1, Name: "backfill", Up: up}, wantSame: true},
+		{name: "renamed", migration: Migration{Version: 1, Name: "backfill_orders", Up: up}},
+		{name: "checksum added", migration: Migration{Version: 1, Name: "backfill", Checksum: "v2", Up: up}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checksumOf(t, tt.migration)
+			if (got == base) != tt.wantSame {
+				t.Errorf("checksum equal to the original = %v, want %v", got == base, tt.wantSame)
+			}
+		})
+	}
+
+	v2 := checksumOf(t, Migration{Version: 1, Name: "backfill", Checksum: "v2", Up: up})
+	v3 := checksumOf(t, Migration{Version: 1, Name: "backfill", Checksum: "v3", Up: up})
+
+	if v2 == v3 {
+		t.Error("changing Checksum did not change the recorded checksum")
+	}
+}
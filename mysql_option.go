@@ -0,0 +1,292 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	// defaultPingTimeout bounds the startup connectivity check of the primary and every replica.
+	defaultPingTimeout = 5 * time.Second
+)
+
+// mysqlOptions collects the settings applied by [MysqlOption] values.
+type mysqlOptions struct {
+	name string
+
+	logLevel      logger.LogLevel
+	slowThreshold time.Duration
+
+	tablePrefix   string
+	singularTable bool
+
+	plugins     []gorm.Plugin
+	prepareStmt bool
+
+	pingTimeout time.Duration
+
+	statementTimeout   time.Duration
+	executionTimeHints bool
+
+	poolSetters []func(*sql.DB)
+
+	circuitBreaker *CircuitBreakerSettings
+
+	audit *AuditSettings
+
+	queryStats *QueryStatsSettings
+
+	queryCacheRedis    *RedisClient
+	queryCacheSettings QueryCacheSettings
+
+	replicaDsns   []string
+	replicaPolicy ReplicaPolicy
+}
+
+// MysqlOption customizes a client built by [NewMysqlClientWithOptions].
+type MysqlOption func(*mysqlOptions)
+
+// WithClientName sets the name used as the client's metric label. It defaults to the database name in the DSN.
+func WithClientName(name string) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.name = name
+	}
+}
+
+// WithLogLevel sets the GORM log level. The default is [logger.Error]; [logger.Info] logs every executed statement.
+func WithLogLevel(level logger.LogLevel) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.logLevel = level
+	}
+}
+
+// WithSlowThreshold sets the initial slow-query threshold; see [MysqlClient.SetSlowThreshold].
+func WithSlowThreshold(threshold time.Duration) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.slowThreshold = threshold
+	}
+}
+
+// WithSingularTable makes GORM derive singular table names from model names, such as user instead of users.
+func WithSingularTable() MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.singularTable = true
+	}
+}
+
+// WithTablePrefix prepends prefix to every table name derived by GORM.
+func WithTablePrefix(prefix string) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.tablePrefix = prefix
+	}
+}
+
+// WithPlugins registers additional GORM plugins, such as the sharding middleware returned by [MonthlyShardingByOid].
+func WithPlugins(plugins ...gorm.Plugin) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.plugins = append(opts.plugins, plugins...)
+	}
+}
+
+// WithPrepareStmt caches prepared statements on the primary connection pool and on every replica pool.
+func WithPrepareStmt() MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.prepareStmt = true
+	}
+}
+
+// WithPingTimeout bounds the startup ping of the primary and every replica. The default is 5s;
+// a non-positive value uses the constructor context without an additional timeout.
+func WithPingTimeout(timeout time.Duration) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.pingTimeout = timeout
+	}
+}
+
+// WithStatementTimeout bounds every statement whose context has no deadline by timeout. Statements that run out of
+// time are labeled TIMEOUT in [MysqlHistogram]. By default no timeout is applied. [Migrator] statements are exempt.
+func WithStatementTimeout(timeout time.Duration) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.statementTimeout = timeout
+	}
+}
+
+// WithExecutionTimeHints controls the MAX_EXECUTION_TIME optimizer hint that SELECT statements with a deadline
+// carry, so the server stops them once the caller has given up. Hints are disabled by default.
+func WithExecutionTimeHints(enabled bool) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.executionTimeHints = enabled
+	}
+}
+
+// WithCircuitBreaker installs a circuit breaker that rejects statements and new transactions with [ErrCircuitOpen]
+// once timeouts, connection failures, or slow statements exceed the thresholds of settings, then lets a few probe
+// statements through after a cool-down. Its state is exported by [MysqlCircuitStateGauge].
+func WithCircuitBreaker(settings CircuitBreakerSettings) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.circuitBreaker = &settings
+	}
+}
+
+// WithAudit installs a plugin that stamps the audit columns of settings with the actor of [WithActor] and the
+// current UTC time, records the actor of soft deletes, and, when settings.TrailTable is set, writes a row-level
+// audit trail in the transaction of each change. It also switches GORM's clock to UTC.
+func WithAudit(settings AuditSettings) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.audit = &settings
+	}
+}
+
+// WithQueryStats aggregates latency, rows, and errors per SQL fingerprint, in which literals are replaced by
+// placeholders and IN lists collapsed. The aggregate is kept in process and read through [MysqlClient.QueryStats],
+// so it adds no metric labels.
+func WithQueryStats(settings QueryStatsSettings) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.queryStats = &settings
+	}
+}
+
+// WithQueryCache caches the results of queries that opt in with [WithCachedReads] or [Cached] in redisClient.
+// Writes through the client invalidate the cached results of the tables they touch; hits and misses are counted
+// in [MysqlQueryCacheCounter].
+func WithQueryCache(redisClient *RedisClient, settings QueryCacheSettings) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.queryCacheRedis = redisClient
+		opts.queryCacheSettings = settings
+	}
+}
+
+// WithMaxOpenConns sets the maximum number of open connections of the primary and every replica pool.
+func WithMaxOpenConns(maxOpenConns int) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.poolSetters = append(opts.poolSetters, func(pool *sql.DB) {
+			pool.SetMaxOpenConns(maxOpenConns)
+		})
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections of the primary and every replica pool.
+func WithMaxIdleConns(maxIdleConns int) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.poolSetters = append(opts.poolSetters, func(pool *sql.DB) {
+			pool.SetMaxIdleConns(maxIdleConns)
+		})
+	}
+}
+
+// WithConnMaxLifetime sets the maximum amount of time a connection may be reused.
+func WithConnMaxLifetime(connMaxLifetime time.Duration) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.poolSetters = append(opts.poolSetters, func(pool *sql.DB) {
+			pool.SetConnMaxLifetime(connMaxLifetime)
+		})
+	}
+}
+
+// WithConnMaxIdleTime sets how long an idle connection may remain in the pool.
+func WithConnMaxIdleTime(connMaxIdleTime time.Duration) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.poolSetters = append(opts.poolSetters, func(pool *sql.DB) {
+			pool.SetConnMaxIdleTime(connMaxIdleTime)
+		})
+	}
+}
+
+// WithReplicas routes plain reads to replicaDsns according to policy; see [NewMysqlClientWithReplicas].
+// A nil policy defaults to [RoundRobinReplicaPolicy].
+func WithReplicas(replicaDsns []string, policy ReplicaPolicy) MysqlOption {
+	return func(opts *mysqlOptions) {
+		opts.replicaDsns = replicaDsns
+		opts.replicaPolicy = policy
+	}
+}
+
+// NewMysqlClientWithOptions opens a client for dsn configured by opts. Without options it behaves like [NewMysqlClient].
+func NewMysqlClientWithOptions(ctx context.Context, dsn string, opts ...MysqlOption) (*MysqlClient, error) {
+	mysqlOpts := &mysqlOptions{
+		logLevel:      logger.Error,
+		slowThreshold: defaultSlowThreshold,
+		pingTimeout:   defaultPingTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(mysqlOpts)
+	}
+
+	var stats *QueryStats
+	if mysqlOpts.queryStats != nil {
+		stats = newQueryStats(*mysqlOpts.queryStats)
+	}
+
+	db, err := openDB(ctx, dsn, mysqlOpts, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolver *mysqlResolver
+
+	if len(mysqlOpts.replicaDsns) > 0 {
+		resolver, err = newMysqlResolver(ctx, db, mysqlOpts.replicaDsns, mysqlOpts.replicaPolicy, mysqlOpts.pingTimeout)
+		if err != nil {
+			closeGormDB(db)
+
+			return nil, err
+		}
+	}
+
+	name := mysqlOpts.name
+	if name == "" {
+		name = mysqlDBName(db)
+	}
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		for _, setPool := range mysqlOpts.poolSetters {
+			setPool(sqlDB)
+		}
+	}
+
+	if resolver != nil {
+		for _, pool := range resolver.pools() {
+			for _, setPool := range mysqlOpts.poolSetters {
+				setPool(pool)
+			}
+		}
+	}
+
+	client := newMysqlClient(db, resolver, name)
+
+	client.queryStats = stats
+
+	if cache := client.queryCache(); cache != nil {
+		cache.client = client
+	}
+
+	return client, nil
+}
+
+// pingPool verifies connectivity of pool, bounding the check by timeout when it is positive.
+func pingPool(ctx context.Context, pool *sql.DB, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return pool.PingContext(ctx)
+}
+
+// closeGormDB closes the connection pool behind db, ignoring errors; it is used on constructor failure paths.
+func closeGormDB(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+
+	_ = sqlDB.Close()
+}
@@ -0,0 +1,505 @@
+package tdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/choveylee/tlog"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOutboxTable = "outbox"
+
+	// outboxMetricInterval is how often a running [OutboxRelay] reports backlog and lag.
+	outboxMetricInterval = 15 * time.Second
+
+	// outboxPruneBatch bounds the rows deleted by one pruning statement, keeping each delete short.
+	outboxPruneBatch = 1000
+
+	// outboxMaxErrorLength bounds the last_error column.
+	outboxMaxErrorLength = 1024
+
+	outboxStatusSent   = "sent"
+	outboxStatusRetry  = "retry"
+	outboxStatusFailed = "failed"
+)
+
+// ErrOutboxNotInTx is returned by [Outbox.Add] when the session is not a transaction, since the message would then
+// not commit or roll back together with the business write.
+var ErrOutboxNotInTx = errors.New("mysql outbox add requires a transaction")
+
+// Outbox stores messages in a MySQL table in the same transaction as the writes that produce them, so a message is
+// published if and only if its transaction commits. An [OutboxRelay] publishes the stored messages to Kafka.
+//
+// The table needs the following columns and indexes:
+//
+//	CREATE TABLE outbox (
+//	    id              BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+//	    topic           VARCHAR(255) NOT NULL,
+//	    msg_key         VARCHAR(255) NOT NULL,
+//	    payload         LONGBLOB     NOT NULL,
+//	    attempts        INT          NOT NULL DEFAULT 0,
+//	    last_error      VARCHAR(1024) NULL,
+//	    next_attempt_at DATETIME(3)  NOT NULL,
+//	    created_at      DATETIME(3)  NOT NULL,
+//	    sent_at         DATETIME(3)  NULL,
+//	    failed_at       DATETIME(3)  NULL,
+//	    KEY idx_outbox_pending (sent_at, failed_at, next_attempt_at),
+//	    KEY idx_outbox_key (topic, msg_key, id)
+//	);
+type Outbox struct {
+	client *MysqlClient
+
+	table string
+}
+
+// NewOutbox returns an outbox stored in table of client. An empty table defaults to outbox.
+func NewOutbox(client *MysqlClient, table string) *Outbox {
+	if table == "" {
+		table = defaultOutboxTable
+	}
+
+	return &Outbox{
+		client: client,
+
+		table: table,
+	}
+}
+
+// Add stores payload, encoded as JSON like [KafkaSyncSender.Send] does, for publishing to topic with key. tx must be
+// a transaction, such as the session passed to [MysqlClient.WithTx] or returned by [MysqlClient.Tx]; otherwise Add
+// fails with [ErrOutboxNotInTx].
+func (p *Outbox) Add(tx *gorm.DB, topic, key string, payload any) error {
+	if _, ok := tx.Statement.ConnPool.(gorm.TxCommitter); !ok {
+		return ErrOutboxNotInTx
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode outbox payload: %w", err)
+	}
+
+	now := time.Now().UTC()
+
+	return tx.Session(&gorm.Session{NewDB: true}).Table(p.table).Create(map[string]any{
+		"topic":           topic,
+		"msg_key":         key,
+		"payload":         data,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"created_at":      now,
+	}).Error
+}
+
+// OutboxRelaySettings configures an [OutboxRelay]. Zero fields use the defaults documented on each field.
+type OutboxRelaySettings struct {
+	// PollInterval is the pause between polls once no due messages are left. The default is 1s.
+	PollInterval time.Duration
+
+	// BatchSize is the maximum number of messages locked and published per transaction. The default is 100.
+	BatchSize int
+
+	// MaxAttempts is the number of failed publishes after which a message is marked failed and no longer retried.
+	// Later messages with the same key then proceed. The default is 10.
+	MaxAttempts int
+
+	// RetryInitialInterval is the wait after the first failed publish; it doubles with every further failure.
+	// The default is 1s.
+	RetryInitialInterval time.Duration
+
+	// RetryMaxInterval caps the wait between publish attempts. The default is 5m.
+	RetryMaxInterval time.Duration
+
+	// SendTimeout bounds each publish, since the batch's rows stay locked and its primary connection busy while it
+	// runs. A publish that times out counts as failed and ends the batch; the rest wait for the next poll. The
+	// default is 10s.
+	SendTimeout time.Duration
+
+	// Retention is how long sent messages are kept before they are pruned. The default is 7 days.
+	// Failed messages are kept for inspection.
+	Retention time.Duration
+
+	// PruneInterval is how often sent messages beyond Retention are deleted. The default is 1h.
+	PruneInterval time.Duration
+}
+
+// withDefaults returns p with zero fields replaced by their defaults.
+func (p OutboxRelaySettings) withDefaults() OutboxRelaySettings {
+	if p.PollInterval <= 0 {
+		p.PollInterval = time.Second
+	}
+
+	if p.BatchSize <= 0 {
+		p.BatchSize = 100
+	}
+
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 10
+	}
+
+	if p.RetryInitialInterval <= 0 {
+		p.RetryInitialInterval = time.Second
+	}
+
+	if p.RetryMaxInterval <= 0 {
+		p.RetryMaxInterval = 5 * time.Minute
+	}
+
+	if p.SendTimeout <= 0 {
+		p.SendTimeout = 10 * time.Second
+	}
+
+	if p.Retention <= 0 {
+		p.Retention = 7 * 24 * time.Hour
+	}
+
+	if p.PruneInterval <= 0 {
+		p.PruneInterval = time.Hour
+	}
+
+	return p
+}
+
+func (p OutboxRelaySettings) newRetryBackOff() *backoff.ExponentialBackOff {
+	retryBackOff := backoff.NewExponentialBackOff()
+
+	retryBackOff.InitialInterval = p.RetryInitialInterval
+	retryBackOff.MaxInterval = p.RetryMaxInterval
+	retryBackOff.Multiplier = 2
+	retryBackOff.RandomizationFactor = 0
+	retryBackOff.MaxElapsedTime = 0
+
+	retryBackOff.Reset()
+
+	return retryBackOff
+}
+
+// retryDelay returns the wait after the given number of failed attempts. The attempts are counted in the table
+// rather than in a live backoff, so the backoff is replayed up to the current attempt.
+func (p OutboxRelaySettings) retryDelay(attempts int) time.Duration {
+	retryBackOff := p.newRetryBackOff()
+
+	delay := retryBackOff.NextBackOff()
+
+	for i := 1; i < attempts && delay < p.RetryMaxInterval; i++ {
+		delay = retryBackOff.NextBackOff()
+	}
+
+	return delay
+}
+
+// outboxMessage is a due message locked by the relay.
+type outboxMessage struct {
+	Id       int64
+	Topic    string
+	MsgKey   string
+	Payload  []byte
+	Attempts int
+}
+
+// OutboxRelay publishes the messages of an [Outbox] through [KafkaSyncSender] values, one per topic.
+//
+// Each poll locks a batch of due messages with SELECT ... FOR UPDATE SKIP LOCKED, publishes them in id order, and
+// marks them sent in the same transaction, so several relays can run against one table. Delivery is at least once:
+// a message published shortly before its transaction fails is published again. Messages sharing a key keep their
+// order while a single relay serves their topic: a failed message holds back later messages with its key until it
+// is sent or marked failed.
+type OutboxRelay struct {
+	outbox *Outbox
+
+	settings OutboxRelaySettings
+	senders  map[string]*KafkaSyncSender
+
+	startOnce sync.Once
+	stop      chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewRelay returns a relay that publishes the messages of the senders' topics. Messages of other topics are left
+// for other relays.
+func (p *Outbox) NewRelay(settings OutboxRelaySettings, senders ...*KafkaSyncSender) *OutboxRelay {
+	relay := &OutboxRelay{
+		outbox: p,
+
+		settings: settings.withDefaults(),
+		senders:  make(map[string]*KafkaSyncSender, len(senders)),
+
+		stop: make(chan struct{}),
+	}
+
+	for _, sender := range senders {
+		relay.senders[sender.topic] = sender
+	}
+
+	return relay
+}
+
+// Start launches the relay loop in a goroutine. It runs until ctx is done or [OutboxRelay.Close] is called;
+// further calls have no effect.
+func (p *OutboxRelay) Start(ctx context.Context) {
+	p.startOnce.Do(func() {
+		p.wg.Add(1)
+
+		go p.run(ctx)
+	})
+}
+
+// Close stops the relay loop and waits for the current batch to finish, or returns the error of ctx once it is done.
+// It does not close the senders.
+func (p *OutboxRelay) Close(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+
+	done := make(chan struct{})
+
+	go func() {
+		p.wg.Wait()
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *OutboxRelay) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	pollTimer := time.NewTimer(0)
+	defer pollTimer.Stop()
+
+	metricTicker := time.NewTicker(outboxMetricInterval)
+	defer metricTicker.Stop()
+
+	pruneTicker := time.NewTicker(p.settings.PruneInterval)
+	defer pruneTicker.Stop()
+
+	p.reportBacklog(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-metricTicker.C:
+			p.reportBacklog(ctx)
+		case <-pruneTicker.C:
+			p.prune(ctx)
+		case <-pollTimer.C:
+			count, err := p.relayBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				tlog.E(ctx).Err(err).Msgf("MySQL outbox %q relay failed and will retry.", p.outbox.table)
+			}
+
+			// A full batch suggests more due messages; poll again right away.
+			wait := p.settings.PollInterval
+			if err == nil && count >= p.settings.BatchSize {
+				wait = 0
+			}
+
+			pollTimer.Reset(wait)
+		}
+	}
+}
+
+// relayBatch publishes one batch of due messages and returns how many it locked.
+func (p *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	if len(p.senders) == 0 {
+		return 0, nil
+	}
+
+	topics := slices.Sorted(maps.Keys(p.senders))
+
+	var count int
+
+	err := p.outbox.client.WithTx(ctx, ReleaseMode, func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+
+		// Skip messages whose key has an earlier message waiting for a retry, so the key's order is kept.
+		var messages []*outboxMessage
+
+		err := tx.Raw("SELECT `id`, `topic`, `msg_key`, `payload`, `attempts` FROM `"+p.outbox.table+"` AS o "+
+			"WHERE o.`sent_at` IS NULL AND o.`failed_at` IS NULL AND o.`next_attempt_at` <= ? AND o.`topic` IN ? "+
+			"AND NOT EXISTS (SELECT 1 FROM `"+p.outbox.table+"` AS e WHERE e.`topic` = o.`topic` "+
+			"AND e.`msg_key` = o.`msg_key` AND e.`id` < o.`id` AND e.`sent_at` IS NULL AND e.`failed_at` IS NULL "+
+			"AND e.`next_attempt_at` > ?) "+
+			"ORDER BY o.`id` LIMIT ? FOR UPDATE SKIP LOCKED",
+			now, topics, now, p.settings.BatchSize).Scan(&messages).Error
+		if err != nil {
+			return fmt.Errorf("lock outbox messages: %w", err)
+		}
+
+		count = len(messages)
+
+		sentIds := make([]int64, 0, len(messages))
+		heldKeys := make(map[[2]string]bool)
+
+		for _, message := range messages {
+			key := [2]string{message.Topic, message.MsgKey}
+			if heldKeys[key] {
+				continue
+			}
+
+			sendErr := p.send(ctx, message)
+			if sendErr == nil {
+				sentIds = append(sentIds, message.Id)
+
+				continue
+			}
+
+			heldKeys[key] = true
+
+			err = p.markFailedAttempt(tx, message, now, sendErr)
+			if err != nil {
+				return err
+			}
+
+			// The broker is slow; stop holding the locks of the remaining messages on its account.
+			if errors.Is(sendErr, context.DeadlineExceeded) {
+				break
+			}
+		}
+
+		if len(sentIds) == 0 {
+			return nil
+		}
+
+		err = tx.Table(p.outbox.table).Where("`id` IN ?", sentIds).Update("sent_at", now).Error
+		if err != nil {
+			return fmt.Errorf("mark outbox messages sent: %w", err)
+		}
+
+		MysqlOutboxCounter.Add(float64(len(sentIds)), p.outbox.table, outboxStatusSent)
+
+		return nil
+	})
+
+	return count, err
+}
+
+// send publishes message within SendTimeout. [KafkaSyncSender.Send] cannot be interrupted, so a publish that times
+// out keeps running in the background and may still be delivered, which the next attempt then repeats; delivery is
+// at least once in any case.
+func (p *OutboxRelay) send(ctx context.Context, message *outboxMessage) error {
+	sendCtx, cancel := context.WithTimeout(ctx, p.settings.SendTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, _, err := p.senders[message.Topic].Send(sendCtx, message.MsgKey, json.RawMessage(message.Payload))
+
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-sendCtx.Done():
+		return fmt.Errorf("publish outbox message %d: %w", message.Id, sendCtx.Err())
+	}
+}
+
+// markFailedAttempt records a failed publish and schedules the next attempt, or marks the message failed once
+// MaxAttempts is reached.
+func (p *OutboxRelay) markFailedAttempt(tx *gorm.DB, message *outboxMessage, now time.Time, sendErr error) error {
+	attempts := message.Attempts + 1
+
+	lastError := sendErr.Error()
+	if len(lastError) > outboxMaxErrorLength {
+		lastError = lastError[:outboxMaxErrorLength]
+	}
+
+	updates := map[string]any{
+		"attempts":   attempts,
+		"last_error": lastError,
+	}
+
+	status := outboxStatusRetry
+
+	if attempts >= p.settings.MaxAttempts {
+		status = outboxStatusFailed
+
+		updates["failed_at"] = now
+
+		tlog.E(tx.Statement.Context).Err(sendErr).Detailf("id:%d", message.Id).Detailf("attempts:%d", attempts).
+			Msgf("MySQL outbox %q message to topic %q failed permanently.", p.outbox.table, message.Topic)
+	} else {
+		updates["next_attempt_at"] = now.Add(p.settings.retryDelay(attempts))
+
+		tlog.W(tx.Statement.Context).Err(sendErr).Detailf("id:%d", message.Id).Detailf("attempts:%d", attempts).
+			Msgf("MySQL outbox %q message to topic %q will be retried.", p.outbox.table, message.Topic)
+	}
+
+	err := tx.Table(p.outbox.table).Where("`id` = ?", message.Id).Updates(updates).Error
+	if err != nil {
+		return fmt.Errorf("record outbox attempt: %w", err)
+	}
+
+	MysqlOutboxCounter.Inc(p.outbox.table, status)
+
+	return nil
+}
+
+// reportBacklog sets [MysqlOutboxBacklogGauge] and [MysqlOutboxLagGauge] from the pending messages of the table.
+func (p *OutboxRelay) reportBacklog(ctx context.Context) {
+	var backlog struct {
+		Pending  int64
+		LagMicro int64
+	}
+
+	err := p.outbox.client.DB(WithPrimary(ctx), ReleaseMode).
+		Raw("SELECT COUNT(*) AS pending, COALESCE(TIMESTAMPDIFF(MICROSECOND, MIN(`created_at`), ?), 0) AS lag_micro "+
+			"FROM `"+p.outbox.table+"` WHERE `sent_at` IS NULL AND `failed_at` IS NULL", time.Now().UTC()).
+		Scan(&backlog).Error
+	if err != nil {
+		tlog.W(ctx).Err(err).Msgf("MySQL outbox %q backlog could not be measured.", p.outbox.table)
+
+		return
+	}
+
+	MysqlOutboxBacklogGauge.Set(float64(backlog.Pending), p.outbox.table)
+	MysqlOutboxLagGauge.Set(float64(max(backlog.LagMicro, 0))/1000, p.outbox.table)
+}
+
+// prune deletes sent messages older than the retention in bounded batches.
+func (p *OutboxRelay) prune(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-p.settings.Retention)
+
+	var pruned int64
+
+	for ctx.Err() == nil {
+		result := p.outbox.client.DB(ctx, ReleaseMode).
+			Exec("DELETE FROM `"+p.outbox.table+"` WHERE `sent_at` < ? LIMIT ?", cutoff, outboxPruneBatch)
+		if result.Error != nil {
+			tlog.W(ctx).Err(result.Error).Msgf("MySQL outbox %q pruning failed.", p.outbox.table)
+
+			break
+		}
+
+		pruned += result.RowsAffected
+
+		if result.RowsAffected < outboxPruneBatch {
+			break
+		}
+	}
+
+	if pruned > 0 {
+		tlog.I(ctx).Detailf("rows:%d", pruned).Msgf("MySQL outbox %q pruned.", p.outbox.table)
+	}
+}
@@ -0,0 +1,94 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings OutboxRelaySettings
+		attempts int
+		want     time.Duration
+	}{
+		{name: "first failure", attempts: 1, want: time.Second},
+		{name: "second failure", attempts: 2, want: 2 * time.Second},
+		{name: "fifth failure", attempts: 5, want: 16 * time.Second},
+		{name: "capped", attempts: 10, want: 5 * time.Minute},
+		{name: "far beyond the cap", attempts: 1000, want: 5 * time.Minute},
+		{
+			name:     "custom intervals",
+			settings: OutboxRelaySettings{RetryInitialInterval: 100 * time.Millisecond, RetryMaxInterval: time.Second},
+			attempts: 4,
+			want:     800 * time.Millisecond,
+		},
+		{
+			name:     "custom cap",
+			settings: OutboxRelaySettings{RetryInitialInterval: 100 * time.Millisecond, RetryMaxInterval: time.Second},
+			attempts: 5,
+			want:     time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.settings.withDefaults().retryDelay(tt.attempts)
+			if got != tt.want {
+				t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+// blockingProducer is a [sarama.SyncProducer] whose sends wait until release is closed.
+type blockingProducer struct {
+	sarama.SyncProducer
+
+	release chan struct{}
+}
+
+func (p *blockingProducer) SendMessage(*sarama.ProducerMessage) (int32, int64, error) {
+	<-p.release
+
+	return 0, 0, nil
+}
+
+func TestOutboxRelaySendTimeout(t *testing.T) {
+	producer := &blockingProducer{release: make(chan struct{})}
+	defer close(producer.release)
+
+	relay := NewOutbox(nil, "").NewRelay(OutboxRelaySettings{SendTimeout: 10 * time.Millisecond},
+		&KafkaSyncSender{producer: producer, topic: "orders"})
+
+	err := relay.send(context.Background(), &outboxMessage{Id: 1, Topic: "orders", Payload: []byte("{}")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("send() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestOutboxRelayCloseHonorsContext(t *testing.T) {
+	relay := NewOutbox(nil, "").NewRelay(OutboxRelaySettings{})
+
+	// A batch that is still running.
+	relay.wg.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := relay.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	relay.wg.Done()
+
+	err = relay.Close(context.Background())
+	if err != nil {
+		t.Errorf("Close() error = %v after the batch finished", err)
+	}
+}
@@ -0,0 +1,535 @@
+package tdb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	cursorForward  = "next"
+	cursorBackward = "prev"
+)
+
+// ErrInvalidCursor is returned by [Paginate] when a cursor token is malformed, was signed with a different secret,
+// or was issued by a [Paginator] with different columns or for a different table or scope.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// CursorColumn is one column of a keyset ordering.
+type CursorColumn struct {
+	// Name is the database column name.
+	Name string
+
+	// Desc orders the column in descending order.
+	Desc bool
+}
+
+// Paginator describes a keyset ordering and signs the cursor tokens it issues. The columns must form a unique key,
+// typically by ending with the primary key, so that every row has a distinct position.
+//
+// Hex-encoded ObjectID strings sort in creation order, so an ObjectID primary key works as a chronological keyset.
+// Tables sharded with [MonthlyShardingByOid] or [MonthlyShardingByTime] are paged with a paginator returned by
+// [Paginator.AcrossMonthlyShards].
+type Paginator struct {
+	columns []CursorColumn
+	secret  []byte
+	sharded bool
+
+	signature string
+}
+
+// NewPaginator returns a [Paginator] ordering rows by columns and signing cursors with secret using HMAC-SHA256.
+func NewPaginator(secret []byte, columns ...CursorColumn) (*Paginator, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("pagination secret must not be empty")
+	}
+
+	if len(columns) == 0 {
+		return nil, errors.New("pagination requires at least one column")
+	}
+
+	parts := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if column.Name == "" {
+			return nil, errors.New("pagination column name must not be empty")
+		}
+
+		if column.Desc {
+			parts = append(parts, column.Name+":desc")
+		} else {
+			parts = append(parts, column.Name+":asc")
+		}
+	}
+
+	paginator := &Paginator{
+		columns: slices.Clone(columns),
+		secret:  slices.Clone(secret),
+
+		signature: strings.Join(parts, ","),
+	}
+
+	return paginator, nil
+}
+
+// AcrossMonthlyShards returns a copy of the paginator for logical tables sharded with [MonthlyShardingByOid] or
+// [MonthlyShardingByTime]. The sharding middleware cannot route a range condition on the sharding key, so
+// [Paginate] queries the physical monthly shards directly, continuing in the next or previous month's shard when a
+// page comes up short, and records the shard in the cursor. The first column must be the sharding key so that
+// shard order matches row order. Each page lists the shards from information_schema with one extra query.
+func (p *Paginator) AcrossMonthlyShards() *Paginator {
+	paginator := *p
+
+	paginator.sharded = true
+
+	return &paginator
+}
+
+// Page is one page of keyset pagination results.
+type Page[T any] struct {
+	Items []T
+
+	// NextCursor fetches the page after Items; it is empty when no later row exists.
+	NextCursor string
+
+	// PrevCursor fetches the page before Items; it is empty on the first page.
+	PrevCursor string
+}
+
+// cursorValue is one key value of a cursor, tagged with its Go type so it decodes to the same SQL argument type.
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+// cursorPayload is the signed content of a cursor token.
+type cursorPayload struct {
+	Direction string        `json:"d"`
+	Columns   string        `json:"c"`
+	Shard     string        `json:"s,omitempty"`
+	Values    []cursorValue `json:"v"`
+}
+
+// Paginate returns up to limit rows of T selected by db, positioned after (or before) cursor according to paginator.
+// An empty cursor returns the first page. db may carry filters, a table override such as a physical shard,
+// or the ambient transaction; it is not modified.
+//
+// Cursors are bound to the table and to scope, which should identify the caller-dependent filters applied to db,
+// such as "user:42"; a cursor issued for another table or scope fails with [ErrInvalidCursor].
+func Paginate[T any](db *gorm.DB, paginator *Paginator, scope string, cursor string, limit int) (*Page[T], error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid page limit %d", limit)
+	}
+
+	stmt := &gorm.Statement{DB: db}
+
+	err := stmt.Parse(new(T))
+	if err != nil {
+		return nil, fmt.Errorf("parse model %T: %w", *new(T), err)
+	}
+
+	table := db.Statement.Table
+	if table == "" {
+		table = stmt.Schema.Table
+	}
+
+	direction := cursorForward
+
+	var (
+		keyValues []any
+		shard     string
+	)
+
+	if cursor != "" {
+		payload, err := paginator.decode(cursor, table, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		direction = payload.Direction
+		shard = payload.Shard
+
+		keyValues, err = decodeCursorValues(payload.Values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backward := direction == cursorBackward
+
+	// An empty shard name queries the table selected by db itself.
+	shards := []string{""}
+
+	if paginator.sharded {
+		shards, err = paginator.shardsFrom(db, table, shard, backward)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]T, 0, limit+1)
+	itemShards := make([]string, 0, limit+1)
+
+	for _, shardTable := range shards {
+		tx := db.Session(&gorm.Session{})
+
+		if shardTable != "" {
+			tx = tx.Table(shardTable)
+		}
+
+		// Only the cursor's own shard needs the keyset condition; every row of a later shard is beyond the cursor.
+		if keyValues != nil && shardTable == shard {
+			tx = tx.Where(paginator.keysetCondition(keyValues, backward))
+		}
+
+		for _, column := range paginator.columns {
+			tx = tx.Order(clause.OrderByColumn{
+				Column: clause.Column{Name: column.Name},
+				Desc:   column.Desc != backward,
+			})
+		}
+
+		batch := make([]T, 0, limit+1-len(items))
+
+		err = tx.Limit(limit + 1 - len(items)).Find(&batch).Error
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, batch...)
+
+		for range batch {
+			itemShards = append(itemShards, shardTable)
+		}
+
+		if len(items) > limit {
+			break
+		}
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+		itemShards = itemShards[:limit]
+	}
+
+	if backward {
+		slices.Reverse(items)
+		slices.Reverse(itemShards)
+	}
+
+	page := &Page[T]{
+		Items: items,
+	}
+
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	position := cursorPosition{
+		table: table,
+		scope: scope,
+	}
+
+	if hasMore || backward {
+		position.direction, position.shard = cursorForward, itemShards[len(items)-1]
+
+		page.NextCursor, err = paginator.encodeRow(db.Statement.Context, stmt, items[len(items)-1], position)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if (hasMore && backward) || (!backward && cursor != "") {
+		position.direction, position.shard = cursorBackward, itemShards[0]
+
+		page.PrevCursor, err = paginator.encodeRow(db.Statement.Context, stmt, items[0], position)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// cursorPosition is what a cursor is issued for besides the key values of its row.
+type cursorPosition struct {
+	direction string
+	shard     string
+	table     string
+	scope     string
+}
+
+// shardsFrom lists the monthly shards of table in paging order, starting at the shard of the cursor. A cursor whose
+// shard has since been dropped continues with the next existing shard.
+func (p *Paginator) shardsFrom(db *gorm.DB, table string, shard string, backward bool) ([]string, error) {
+	shards, err := monthlyShards(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shard names sort chronologically, and a descending first column pages from the newest shard to the oldest.
+	if p.columns[0].Desc != backward {
+		slices.Reverse(shards)
+	}
+
+	if shard == "" {
+		return shards, nil
+	}
+
+	start := slices.IndexFunc(shards, func(name string) bool {
+		if p.columns[0].Desc != backward {
+			return name <= shard
+		}
+
+		return name >= shard
+	})
+	if start < 0 {
+		return nil, nil
+	}
+
+	return shards[start:], nil
+}
+
+// monthlyShards lists the physical monthly shards of table in the current database in chronological order.
+func monthlyShards(db *gorm.DB, table string) ([]string, error) {
+	names := make([]string, 0)
+
+	pattern := strings.NewReplacer(`\`, `\\`, `_`, `\_`, `%`, `\%`).Replace(table) + `\_%`
+
+	err := db.Session(&gorm.Session{NewDB: true}).Raw(
+		"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE ?",
+		pattern).Scan(&names).Error
+	if err != nil {
+		return nil, fmt.Errorf("list shards of table %s: %w", table, err)
+	}
+
+	shards := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if isMonthlyShard(table, name) {
+			shards = append(shards, name)
+		}
+	}
+
+	sort.Strings(shards)
+
+	return shards, nil
+}
+
+// isMonthlyShard reports whether name is table followed by a _YYYYMM suffix.
+func isMonthlyShard(table string, name string) bool {
+	suffix, ok := strings.CutPrefix(name, table+"_")
+	if !ok || len(suffix) != len("200601") {
+		return false
+	}
+
+	for i := 0; i < len(suffix); i++ {
+		if !isDigit(suffix[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keysetCondition builds (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ..., flipping each comparison for descending
+// columns and again when paging backward.
+func (p *Paginator) keysetCondition(keyValues []any, backward bool) clause.Expression {
+	disjuncts := make([]clause.Expression, 0, len(p.columns))
+
+	for i, column := range p.columns {
+		conjuncts := make([]clause.Expression, 0, i+1)
+
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, clause.Eq{Column: clause.Column{Name: p.columns[j].Name}, Value: keyValues[j]})
+		}
+
+		after := column.Desc == backward
+		if after {
+			conjuncts = append(conjuncts, clause.Gt{Column: clause.Column{Name: column.Name}, Value: keyValues[i]})
+		} else {
+			conjuncts = append(conjuncts, clause.Lt{Column: clause.Column{Name: column.Name}, Value: keyValues[i]})
+		}
+
+		disjuncts = append(disjuncts, clause.And(conjuncts...))
+	}
+
+	return clause.Or(disjuncts...)
+}
+
+// encodeRow issues a signed cursor positioned at item.
+func (p *Paginator) encodeRow(ctx context.Context, stmt *gorm.Statement, item any,
+	position cursorPosition) (string, error) {
+	rowValue := reflect.Indirect(reflect.ValueOf(item))
+
+	values := make([]cursorValue, 0, len(p.columns))
+
+	for _, column := range p.columns {
+		field := stmt.Schema.LookUpField(column.Name)
+		if field == nil {
+			return "", fmt.Errorf("pagination column %q not found in model %s", column.Name, stmt.Schema.Name)
+		}
+
+		fieldValue, _ := field.ValueOf(ctx, rowValue)
+
+		value, err := encodeCursorValue(fieldValue)
+		if err != nil {
+			return "", fmt.Errorf("encode pagination column %q: %w", column.Name, err)
+		}
+
+		values = append(values, value)
+	}
+
+	payload, err := json.Marshal(&cursorPayload{
+		Direction: position.direction,
+		Columns:   p.signature,
+		Shard:     position.shard,
+		Values:    values,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := p.sign(position.table, position.scope, encodedPayload)
+
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(mac), nil
+}
+
+// decode verifies the signature of token for table and scope and returns its payload.
+func (p *Paginator) decode(token string, table string, scope string) (*cursorPayload, error) {
+	encodedPayload, encodedMac, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMac)
+	if err != nil || !hmac.Equal(mac, p.sign(table, scope, encodedPayload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	payload := &cursorPayload{}
+
+	err = json.Unmarshal(rawPayload, payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if payload.Columns != p.signature || len(payload.Values) != len(p.columns) ||
+		(payload.Direction != cursorForward && payload.Direction != cursorBackward) ||
+		(payload.Shard != "") != p.sharded || (payload.Shard != "" && !isMonthlyShard(table, payload.Shard)) {
+		return nil, ErrInvalidCursor
+	}
+
+	return payload, nil
+}
+
+// sign computes the MAC of a cursor payload issued for table and scope, which are signed without being stored.
+func (p *Paginator) sign(table string, scope string, encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+
+	mac.Write([]byte(table))
+	mac.Write([]byte{0})
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write([]byte(encodedPayload))
+
+	return mac.Sum(nil)
+}
+
+// encodeCursorValue converts a key value into its tagged string form.
+func encodeCursorValue(value any) (cursorValue, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		driverValue, err := valuer.Value()
+		if err != nil {
+			return cursorValue{}, err
+		}
+
+		value = driverValue
+	}
+
+	switch v := value.(type) {
+	case string:
+		return cursorValue{Type: "s", Value: v}, nil
+	case []byte:
+		return cursorValue{Type: "x", Value: base64.RawURLEncoding.EncodeToString(v)}, nil
+	case bool:
+		return cursorValue{Type: "b", Value: strconv.FormatBool(v)}, nil
+	case time.Time:
+		return cursorValue{Type: "t", Value: v.Format(time.RFC3339Nano)}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{Type: "i", Value: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{Type: "u", Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{Type: "f", Value: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	case reflect.String:
+		return cursorValue{Type: "s", Value: rv.String()}, nil
+	default:
+		return cursorValue{}, fmt.Errorf("unsupported key type %T", value)
+	}
+}
+
+// decodeCursorValues converts tagged cursor values back into SQL arguments.
+func decodeCursorValues(values []cursorValue) ([]any, error) {
+	keyValues := make([]any, 0, len(values))
+
+	for _, value := range values {
+		var (
+			keyValue any
+			err      error
+		)
+
+		switch value.Type {
+		case "s":
+			keyValue = value.Value
+		case "x":
+			keyValue, err = base64.RawURLEncoding.DecodeString(value.Value)
+		case "b":
+			keyValue, err = strconv.ParseBool(value.Value)
+		case "t":
+			keyValue, err = time.Parse(time.RFC3339Nano, value.Value)
+		case "i":
+			keyValue, err = strconv.ParseInt(value.Value, 10, 64)
+		case "u":
+			keyValue, err = strconv.ParseUint(value.Value, 10, 64)
+		case "f":
+			keyValue, err = strconv.ParseFloat(value.Value, 64)
+		default:
+			err = fmt.Errorf("unknown key type %q", value.Type)
+		}
+
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		keyValues = append(keyValues, keyValue)
+	}
+
+	return keyValues, nil
+}
@@ -0,0 +1,274 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type paginationTestStatus string
+
+type paginationTestRow struct {
+	Id        uint64
+	Name      string
+	CreatedAt time.Time
+}
+
+// parseTestSchema parses the schema of model, a pointer to a test struct, with the default naming strategy.
+func parseTestSchema(t *testing.T, model any) *schema.Schema {
+	t.Helper()
+
+	modelSchema, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return modelSchema
+}
+
+func TestNewPaginator(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  []byte
+		columns []CursorColumn
+		wantErr bool
+	}{
+		{name: "valid", secret: []byte("k"), columns: []CursorColumn{{Name: "created_at", Desc: true}, {Name: "id"}}},
+		{name: "empty secret", columns: []CursorColumn{{Name: "id"}}, wantErr: true},
+		{name: "no columns", secret: []byte("k"), wantErr: true},
+		{name: "empty column name", secret: []byte("k"), columns: []CursorColumn{{Name: ""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPaginator(tt.secret, tt.columns...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPaginator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCursorValues(t *testing.T) {
+	createdAt := time.Date(2026, 3, 4, 5, 6, 7, 890, time.UTC)
+
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "string", value: "abc", want: "abc"},
+		{name: "bytes", value: []byte{0, 1, 255}, want: []byte{0, 1, 255}},
+		{name: "bool", value: true, want: true},
+		{name: "time", value: createdAt, want: createdAt},
+		{name: "int", value: int32(-7), want: int64(-7)},
+		{name: "uint", value: uint64(1 << 63), want: uint64(1 << 63)},
+		{name: "float", value: 1.25, want: 1.25},
+		{name: "named string", value: paginationTestStatus("x"), want: "x"},
+		{name: "valuer", value: sql.NullInt64{Int64: 9, Valid: true}, want: int64(9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := encodeCursorValue(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := decodeCursorValues([]cursorValue{encoded})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("round trip of %#v = %#v, want %#v", tt.value, got[0], tt.want)
+			}
+		})
+	}
+
+	_, err := encodeCursorValue(struct{}{})
+	if err == nil {
+		t.Error("encodeCursorValue(struct{}{}) succeeded, want an error")
+	}
+
+	for _, value := range []cursorValue{{Type: "i", Value: "x"}, {Type: "t", Value: "now"}, {Type: "?", Value: ""}} {
+		_, err = decodeCursorValues([]cursorValue{value})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursorValues(%v) error = %v, want ErrInvalidCursor", value, err)
+		}
+	}
+}
+
+func TestPaginatorCursor(t *testing.T) {
+	stmt := &gorm.Statement{Schema: parseTestSchema(t, &paginationTestRow{})}
+
+	columns := []CursorColumn{{Name: "created_at", Desc: true}, {Name: "id"}}
+
+	paginator, err := NewPaginator([]byte("secret"), columns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := &paginationTestRow{Id: 42, Name: "a", CreatedAt: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)}
+
+	position := cursorPosition{direction: cursorForward, table: "orders", scope: "user:1"}
+
+	token, err := paginator.encodeRow(context.Background(), stmt, row, position)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := paginator.decode(token, "orders", "user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyValues, err := decodeCursorValues(payload.Values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []any{row.CreatedAt, uint64(42)}
+	if payload.Direction != cursorForward || !reflect.DeepEqual(keyValues, want) {
+		t.Errorf("decode() = %s %v, want %s %v", payload.Direction, keyValues, cursorForward, want)
+	}
+
+	otherSecret, _ := NewPaginator([]byte("other"), columns...)
+	otherColumns, _ := NewPaginator([]byte("secret"), CursorColumn{Name: "created_at"}, CursorColumn{Name: "id"})
+
+	encodedPayload, mac, _ := strings.Cut(token, ".")
+	rawPayload, _ := base64.RawURLEncoding.DecodeString(encodedPayload)
+	tamperedPayload := strings.Replace(string(rawPayload), `"42"`, `"43"`, 1)
+
+	tests := []struct {
+		name      string
+		paginator *Paginator
+		token     string
+		table     string
+		scope     string
+	}{
+		{name: "tampered payload", token: base64.RawURLEncoding.EncodeToString([]byte(tamperedPayload)) + "." + mac},
+		{name: "tampered signature", token: encodedPayload + "." + base64.RawURLEncoding.EncodeToString([]byte("x"))},
+		{name: "missing signature", token: encodedPayload},
+		{name: "garbage", token: "not a cursor"},
+		{name: "wrong secret", paginator: otherSecret, token: token},
+		{name: "different columns", paginator: otherColumns, token: token},
+		{name: "different table", token: token, table: "orders_archive"},
+		{name: "different scope", token: token, scope: "user:2"},
+		{name: "sharded paginator", paginator: paginator.AcrossMonthlyShards(), token: token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := paginator
+			if tt.paginator != nil {
+				decoder = tt.paginator
+			}
+
+			table, scope := "orders", "user:1"
+			if tt.table != "" {
+				table = tt.table
+			}
+			if tt.scope != "" {
+				scope = tt.scope
+			}
+
+			_, err := decoder.decode(tt.token, table, scope)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decode() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestPaginatorShardedCursor(t *testing.T) {
+	stmt := &gorm.Statement{Schema: parseTestSchema(t, &paginationTestRow{})}
+
+	paginator, err := NewPaginator([]byte("secret"), CursorColumn{Name: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sharded := paginator.AcrossMonthlyShards()
+
+	row := &paginationTestRow{Id: 42}
+
+	tests := []struct {
+		name    string
+		shard   string
+		wantErr bool
+	}{
+		{name: "monthly shard", shard: "orders_202603"},
+		{name: "unsharded cursor", shard: "", wantErr: true},
+		{name: "shard of another table", shard: "invoices_202603", wantErr: true},
+		{name: "not a monthly shard", shard: "orders_archive", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := cursorPosition{direction: cursorBackward, shard: tt.shard, table: "orders", scope: "user:1"}
+
+			token, err := sharded.encodeRow(context.Background(), stmt, row, position)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payload, err := sharded.decode(token, "orders", "user:1")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Errorf("decode() error = %v, want ErrInvalidCursor", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if payload.Shard != tt.shard || payload.Direction != cursorBackward {
+				t.Errorf("decode() = %s %s, want %s %s", payload.Direction, payload.Shard, cursorBackward, tt.shard)
+			}
+
+			_, err = paginator.decode(token, "orders", "user:1")
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("unsharded decode() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestIsMonthlyShard(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "orders_202603", want: true},
+		{name: "orders_190001", want: true},
+		{name: "orders", want: false},
+		{name: "orders_", want: false},
+		{name: "orders_2026", want: false},
+		{name: "orders_2026033", want: false},
+		{name: "orders_2026ab", want: false},
+		{name: "orders_items_202603", want: false},
+		{name: "ordersx202603", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isMonthlyShard("orders", tt.name)
+			if got != tt.want {
+				t.Errorf("isMonthlyShard(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package tdb
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (p *MysqlClient) runPoolMetricsReporter() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.reportPoolMetrics()
+		}
+	}
+}
+
+// reportPoolMetrics exports the statistics of the primary pool and of every replica pool.
+func (p *MysqlClient) reportPoolMetrics() {
+	sqlDB, err := p.db.DB()
+	if err == nil {
+		reportMysqlPoolMetrics(p.name, mysqlPrimaryNode, sqlDB.Stats())
+	}
+
+	if p.resolver == nil {
+		return
+	}
+
+	for _, replica := range p.resolver.replicas {
+		reportMysqlPoolMetrics(p.name, replica.name, replica.pool.Stats())
+	}
+}
+
+func reportMysqlPoolMetrics(name, node string, poolStats sql.DBStats) {
+	MysqlConnStatusGauge.Set(float64(poolStats.OpenConnections), name, node, "open")
+	MysqlConnStatusGauge.Set(float64(poolStats.InUse), name, node, "in_use")
+	MysqlConnStatusGauge.Set(float64(poolStats.Idle), name, node, "idle")
+	MysqlPoolOpGauge.Set(float64(poolStats.WaitCount), name, node, "wait_count")
+	MysqlPoolOpGauge.Set(float64(poolStats.WaitDuration.Milliseconds()), name, node, "wait_duration_ms")
+	MysqlPoolOpGauge.Set(float64(poolStats.MaxIdleClosed), name, node, "max_idle_closed")
+	MysqlPoolOpGauge.Set(float64(poolStats.MaxIdleTimeClosed), name, node, "max_idle_time_closed")
+	MysqlPoolOpGauge.Set(float64(poolStats.MaxLifetimeClosed), name, node, "max_lifetime_closed")
+}
@@ -0,0 +1,224 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/choveylee/tlog"
+	"gorm.io/gorm"
+)
+
+// NPlusOneError reports a statement fingerprint repeated beyond the threshold of a [QueryRecorder], typically a
+// query issued once per row of an earlier result instead of once for all of them.
+type NPlusOneError struct {
+	Fingerprint string
+	Table       string
+	Count       int
+
+	// CallSites lists the distinct file:line locations that issued the statement, in first-seen order.
+	CallSites []string
+}
+
+// Error implements error.
+func (p *NPlusOneError) Error() string {
+	return fmt.Sprintf("mysql statement repeated %d times (n+1): %s at %s", p.Count, p.Fingerprint,
+		strings.Join(p.CallSites, ", "))
+}
+
+// QueryRecorderSettings configures a [QueryRecorder]. Zero fields use the defaults documented on each field.
+type QueryRecorderSettings struct {
+	// Threshold is how often one fingerprint may run before it is reported. The default is 10.
+	Threshold int
+
+	// Strict fails every statement beyond the threshold with an [NPlusOneError], which makes N+1 patterns break
+	// tests. Otherwise they are only logged and counted in [MysqlNPlusOneCounter].
+	Strict bool
+
+	// MaxCallSites bounds the call sites kept per fingerprint. The default is 5.
+	MaxCallSites int
+}
+
+// recordedFingerprint tracks the statements of one fingerprint in a [QueryRecorder].
+type recordedFingerprint struct {
+	table     string
+	count     int
+	callSites []string
+	detection *NPlusOneError
+}
+
+// QueryRecorder counts the statements run with a context carrying it, as returned by [WithQueryRecorder], and
+// detects fingerprints repeated beyond its threshold. Create one per request or test.
+type QueryRecorder struct {
+	settings QueryRecorderSettings
+
+	mu           sync.Mutex
+	total        int
+	fingerprints map[string]*recordedFingerprint
+	detections   []*NPlusOneError
+}
+
+// NewQueryRecorder returns an empty recorder.
+func NewQueryRecorder(settings QueryRecorderSettings) *QueryRecorder {
+	if settings.Threshold <= 0 {
+		settings.Threshold = 10
+	}
+
+	if settings.MaxCallSites <= 0 {
+		settings.MaxCallSites = 5
+	}
+
+	return &QueryRecorder{
+		settings: settings,
+
+		fingerprints: make(map[string]*recordedFingerprint),
+	}
+}
+
+type queryRecorderCtxKey struct{}
+
+// WithQueryRecorder returns a context whose statements issued through [MysqlClient.DB], including those of
+// transactions started with it, are counted by recorder.
+func WithQueryRecorder(ctx context.Context, recorder *QueryRecorder) context.Context {
+	return context.WithValue(ctx, queryRecorderCtxKey{}, recorder)
+}
+
+// QueryRecorderFromContext returns the recorder stored by [WithQueryRecorder], or nil.
+func QueryRecorderFromContext(ctx context.Context) *QueryRecorder {
+	if ctx == nil {
+		return nil
+	}
+
+	recorder, _ := ctx.Value(queryRecorderCtxKey{}).(*QueryRecorder)
+
+	return recorder
+}
+
+// Count returns the number of statements recorded.
+func (p *QueryRecorder) Count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.total
+}
+
+// Detections returns the fingerprints that exceeded the threshold, in detection order, with their final counts.
+func (p *QueryRecorder) Detections() []*NPlusOneError {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	detections := make([]*NPlusOneError, 0, len(p.detections))
+
+	for _, detection := range p.detections {
+		recorded := p.fingerprints[detection.Fingerprint]
+
+		detections = append(detections, &NPlusOneError{
+			Fingerprint: detection.Fingerprint,
+			Table:       detection.Table,
+			Count:       recorded.count,
+			CallSites:   slices.Clone(recorded.callSites),
+		})
+	}
+
+	return detections
+}
+
+// Err returns the joined [NPlusOneError] values of [QueryRecorder.Detections], or nil when there were none.
+func (p *QueryRecorder) Err() error {
+	var err error
+
+	for _, detection := range p.Detections() {
+		err = errors.Join(err, detection)
+	}
+
+	return err
+}
+
+// record counts one statement and returns the detection when its fingerprint is beyond the threshold. The
+// returned bool is true only for the statement that crossed it.
+func (p *QueryRecorder) record(fingerprint, table, callSite string) (*NPlusOneError, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total++
+
+	recorded, ok := p.fingerprints[fingerprint]
+	if !ok {
+		recorded = &recordedFingerprint{
+			table: table,
+		}
+
+		p.fingerprints[fingerprint] = recorded
+	}
+
+	recorded.count++
+
+	if callSite != "" && len(recorded.callSites) < p.settings.MaxCallSites &&
+		!slices.Contains(recorded.callSites, callSite) {
+		recorded.callSites = append(recorded.callSites, callSite)
+	}
+
+	if recorded.count <= p.settings.Threshold {
+		return nil, false
+	}
+
+	crossed := recorded.detection == nil
+	if crossed {
+		recorded.detection = &NPlusOneError{
+			Fingerprint: fingerprint,
+			Table:       table,
+		}
+
+		p.detections = append(p.detections, recorded.detection)
+	}
+
+	return &NPlusOneError{
+		Fingerprint: fingerprint,
+		Table:       table,
+		Count:       recorded.count,
+		CallSites:   slices.Clone(recorded.callSites),
+	}, crossed
+}
+
+// registerQueryRecorder wires the recorder hook after every GORM statement processor.
+func registerQueryRecorder(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Query().After("gorm:query").Register("tdb:recorder_after_query", recordQuery),
+		db.Callback().Row().After("gorm:row").Register("tdb:recorder_after_row", recordQuery),
+		db.Callback().Raw().After("gorm:raw").Register("tdb:recorder_after_raw", recordQuery),
+		db.Callback().Create().After("gorm:create").Register("tdb:recorder_after_create", recordQuery),
+		db.Callback().Update().After("gorm:update").Register("tdb:recorder_after_update", recordQuery),
+		db.Callback().Delete().After("gorm:delete").Register("tdb:recorder_after_delete", recordQuery),
+	)
+}
+
+// recordQuery counts the statement in the recorder of its context, logging and counting a fingerprint once it
+// crosses the threshold and failing it in strict mode.
+func recordQuery(db *gorm.DB) {
+	recorder := QueryRecorderFromContext(db.Statement.Context)
+	if recorder == nil || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	table, _, _ := metricLabels(db)
+
+	detection, crossed := recorder.record(fingerprintOf(db), table, callerLocation())
+	if detection == nil {
+		return
+	}
+
+	if crossed {
+		MysqlNPlusOneCounter.Inc(table)
+
+		tlog.W(db.Statement.Context).Detailf("count:%d", detection.Count).
+			Detailf("call_sites:%s", strings.Join(detection.CallSites, ",")).
+			Msgf("MySQL statement on %q repeated beyond the n+1 threshold: %s.", table, detection.Fingerprint)
+	}
+
+	if recorder.settings.Strict {
+		_ = db.AddError(detection)
+	}
+}
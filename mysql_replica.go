@@ -0,0 +1,287 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	// mysqlPrimaryNode is the node label reported for statements served by the primary.
+	mysqlPrimaryNode = "primary"
+
+	mysqlNodeKey = "mysql_node"
+)
+
+// ReplicaPolicy selects the replica that serves a read statement. It receives the number of configured replicas
+// and must return an index in the range [0, replicaCount).
+type ReplicaPolicy func(replicaCount int) int
+
+// RandomReplicaPolicy returns a [ReplicaPolicy] that picks a replica uniformly at random for every read statement.
+func RandomReplicaPolicy() ReplicaPolicy {
+	return func(replicaCount int) int {
+		return rand.IntN(replicaCount)
+	}
+}
+
+// RoundRobinReplicaPolicy returns a [ReplicaPolicy] that cycles through replicas in order.
+func RoundRobinReplicaPolicy() ReplicaPolicy {
+	var counter atomic.Uint64
+
+	return func(replicaCount int) int {
+		return int((counter.Add(1) - 1) % uint64(replicaCount))
+	}
+}
+
+type primaryCtxKey struct{}
+
+// WithPrimary returns a context that forces read statements issued through [MysqlClient.DB] to the primary,
+// which is useful for read-your-writes flows immediately after a write.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+func isPrimaryForced(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	forced, _ := ctx.Value(primaryCtxKey{}).(bool)
+
+	return forced
+}
+
+// mysqlReplica is a read-only connection pool together with its metric node label. connPool is what statements
+// run on: pool itself, or the prepared statement cache in front of it when [WithPrepareStmt] is set.
+type mysqlReplica struct {
+	name     string
+	pool     *sql.DB
+	connPool gorm.ConnPool
+}
+
+// mysqlResolver routes read statements to replicas and everything else to the primary.
+type mysqlResolver struct {
+	primary  gorm.ConnPool
+	replicas []*mysqlReplica
+
+	policy ReplicaPolicy
+}
+
+// openReplicas opens and pings one connection pool per replica DSN. Each pool is opened through the same dialector
+// and prepared statement settings as the primary described by config. Pools opened before a failure are closed.
+func openReplicas(ctx context.Context, config *gorm.Config, replicaDsns []string,
+	pingTimeout time.Duration) ([]*mysqlReplica, error) {
+	replicas := make([]*mysqlReplica, 0, len(replicaDsns))
+
+	closeAll := func() {
+		for _, replica := range replicas {
+			_ = replica.pool.Close()
+		}
+	}
+
+	for i, dsn := range replicaDsns {
+		replicaDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+			Logger:               config.Logger,
+			PrepareStmt:          config.PrepareStmt,
+			PrepareStmtMaxSize:   config.PrepareStmtMaxSize,
+			PrepareStmtTTL:       config.PrepareStmtTTL,
+			DisableAutomaticPing: true,
+		})
+		if err != nil {
+			closeAll()
+
+			return nil, fmt.Errorf("open mysql replica %d: %w", i, err)
+		}
+
+		pool, err := replicaDB.DB()
+		if err != nil {
+			closeAll()
+
+			return nil, fmt.Errorf("open mysql replica %d: %w", i, err)
+		}
+
+		err = pingPool(ctx, pool, pingTimeout)
+		if err != nil {
+			_ = pool.Close()
+			closeAll()
+
+			return nil, fmt.Errorf("ping mysql replica %d: %w", i, err)
+		}
+
+		replicas = append(replicas, &mysqlReplica{
+			name:     "replica-" + strconv.Itoa(i),
+			pool:     pool,
+			connPool: replicaDB.ConnPool,
+		})
+	}
+
+	return replicas, nil
+}
+
+// register wires the routing callbacks in front of every GORM statement processor.
+func (p *mysqlResolver) register(db *gorm.DB) error {
+	p.primary = db.ConnPool
+
+	return errors.Join(
+		db.Callback().Query().Before("gorm:query").Register("tdb:resolve_query", p.resolveRead),
+		db.Callback().Row().Before("gorm:row").Register("tdb:resolve_row", p.resolveRead),
+		db.Callback().Raw().Before("gorm:raw").Register("tdb:resolve_raw", p.resolveWrite),
+		db.Callback().Create().Before("gorm:create").Register("tdb:resolve_create", p.resolveWrite),
+		db.Callback().Update().Before("gorm:update").Register("tdb:resolve_update", p.resolveWrite),
+		db.Callback().Delete().Before("gorm:delete").Register("tdb:resolve_delete", p.resolveWrite),
+	)
+}
+
+// resolveRead sends plain reads to a replica selected by the policy. Statements inside a transaction,
+// locking reads, non-SELECT raw SQL, and contexts marked with [WithPrimary] stay on the primary.
+func (p *mysqlResolver) resolveRead(db *gorm.DB) {
+	if inTransaction(db) {
+		return
+	}
+
+	if isPrimaryForced(db.Statement.Context) || !isReadStatement(db.Statement) {
+		p.resolveWrite(db)
+
+		return
+	}
+
+	replica := p.replicas[p.policy(len(p.replicas))]
+
+	db.Statement.ConnPool = replica.connPool
+
+	markMysqlNode(db, replica.name)
+}
+
+// resolveWrite pins the statement to the primary, undoing any replica assignment left on a reused statement.
+func (p *mysqlResolver) resolveWrite(db *gorm.DB) {
+	if inTransaction(db) {
+		return
+	}
+
+	db.Statement.ConnPool = p.primary
+
+	markMysqlNode(db, mysqlPrimaryNode)
+}
+
+// close releases every replica connection pool.
+func (p *mysqlResolver) close() error {
+	var err error
+
+	for _, replica := range p.replicas {
+		err = errors.Join(err, replica.pool.Close())
+	}
+
+	return err
+}
+
+// pools returns every replica connection pool.
+func (p *mysqlResolver) pools() []*sql.DB {
+	pools := make([]*sql.DB, 0, len(p.replicas))
+
+	for _, replica := range p.replicas {
+		pools = append(pools, replica.pool)
+	}
+
+	return pools
+}
+
+// inTransaction reports whether the statement runs on a transaction-bound connection.
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+
+	return ok
+}
+
+// isReadStatement reports whether the statement is a non-locking read that can be served by a replica.
+func isReadStatement(stmt *gorm.Statement) bool {
+	if _, ok := stmt.Clauses["FOR"]; ok {
+		return false
+	}
+
+	if stmt.SQL.Len() == 0 {
+		return true
+	}
+
+	return isReadSQL(stmt.SQL.String())
+}
+
+// isReadSQL reports whether rawSql is a SELECT or SHOW statement without a locking suffix. It inspects the
+// fingerprint of rawSql, so string literals that merely mention a locking clause do not count.
+func isReadSQL(rawSql string) bool {
+	normalized := strings.ToLower(fingerprintSQL(rawSql))
+
+	if !strings.HasPrefix(normalized, "select") && !strings.HasPrefix(normalized, "show") {
+		return false
+	}
+
+	return !strings.Contains(normalized, "for update") &&
+		!strings.Contains(normalized, "for share") &&
+		!strings.Contains(normalized, "lock in share mode")
+}
+
+// markMysqlNode records which node serves the statement for the metric hooks and the active trace span.
+func markMysqlNode(db *gorm.DB, node string) {
+	db.Set(mysqlNodeKey, node)
+
+	trace.SpanFromContext(db.Statement.Context).SetAttributes(attribute.String("db.node", node))
+}
+
+// mysqlNode returns the node label recorded by the resolver, defaulting to the primary.
+func mysqlNode(db *gorm.DB) string {
+	node, ok := db.Get(mysqlNodeKey)
+	if !ok {
+		return mysqlPrimaryNode
+	}
+
+	name, ok := node.(string)
+	if !ok {
+		return mysqlPrimaryNode
+	}
+
+	return name
+}
+
+// NewMysqlClientWithReplicas returns a client whose read statements are spread across replicaDsns according to policy,
+// while writes, locking reads, and everything inside [MysqlClient.Tx] run on primaryDsn.
+// A nil policy defaults to [RoundRobinReplicaPolicy]. The client uses GORM log level Error.
+func NewMysqlClientWithReplicas(ctx context.Context, primaryDsn string, replicaDsns []string, policy ReplicaPolicy) (*MysqlClient, error) {
+	return NewMysqlClientWithOptions(ctx, primaryDsn, WithReplicas(replicaDsns, policy))
+}
+
+// newMysqlResolver opens the replica pools and registers the routing callbacks on db.
+func newMysqlResolver(ctx context.Context, db *gorm.DB, replicaDsns []string, policy ReplicaPolicy,
+	pingTimeout time.Duration) (*mysqlResolver, error) {
+	replicas, err := openReplicas(ctx, db.Config, replicaDsns, pingTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == nil {
+		policy = RoundRobinReplicaPolicy()
+	}
+
+	resolver := &mysqlResolver{
+		replicas: replicas,
+		policy:   policy,
+	}
+
+	err = resolver.register(db)
+	if err != nil {
+		_ = resolver.close()
+
+		return nil, fmt.Errorf("register mysql replica resolver: %w", err)
+	}
+
+	return resolver, nil
+}
@@ -0,0 +1,37 @@
+package tdb
+
+import (
+	"testing"
+)
+
+func TestIsReadSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawSql string
+		want   bool
+	}{
+		{name: "select", rawSql: "SELECT * FROM orders WHERE id = 1", want: true},
+		{name: "show", rawSql: "SHOW TABLES", want: true},
+		{name: "leading comment", rawSql: "/* report */ SELECT 1", want: true},
+		{name: "insert", rawSql: "INSERT INTO orders (id) VALUES (1)", want: false},
+		{name: "for update", rawSql: "SELECT * FROM orders WHERE id = 1 FOR UPDATE", want: false},
+		{name: "for update across lines", rawSql: "SELECT * FROM orders WHERE id = 1\nFOR\tUPDATE", want: false},
+		{name: "for share", rawSql: "select * from orders for share", want: false},
+		{name: "lock in share mode", rawSql: "SELECT * FROM orders LOCK IN SHARE MODE", want: false},
+		{name: "literal mentioning for update", rawSql: "SELECT * FROM notes WHERE body = 'wait for update'", want: true},
+		{
+			name:   "literal mentioning lock in share mode",
+			rawSql: `SELECT * FROM notes WHERE body LIKE "%lock in share mode%"`,
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isReadSQL(tt.rawSql)
+			if got != tt.want {
+				t.Errorf("isReadSQL(%q) = %v, want %v", tt.rawSql, got, tt.want)
+			}
+		})
+	}
+}
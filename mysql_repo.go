@@ -0,0 +1,176 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotFound is returned by [Repo] lookups that match no row. It replaces [gorm.ErrRecordNotFound].
+var ErrNotFound = errors.New("record not found")
+
+// Repo offers typed CRUD helpers for model T on top of a [MysqlClient]. Every method obtains its session through
+// [MysqlClient.DB], so it joins the ambient transaction of ctx and uses the run mode given to [NewRepo].
+//
+// Methods keyed by primary key accept optional trailing conds, applied as [gorm.DB.Where] arguments, so tables
+// registered with [MonthlyShardingByOid] or [MonthlyShardingByTime] can supply the sharding key alongside it.
+type Repo[T any] struct {
+	client *MysqlClient
+
+	runMode string
+
+	primaryKey string
+}
+
+// NewRepo returns a [Repo] for model T. It parses the model schema once and fails when T is not a valid GORM model.
+func NewRepo[T any](client *MysqlClient, runMode string) (*Repo[T], error) {
+	stmt := &gorm.Statement{DB: client.db}
+
+	err := stmt.Parse(new(T))
+	if err != nil {
+		return nil, fmt.Errorf("parse model %T: %w", *new(T), err)
+	}
+
+	repo := &Repo[T]{
+		client: client,
+
+		runMode: runMode,
+	}
+
+	if stmt.Schema.PrioritizedPrimaryField != nil {
+		repo.primaryKey = stmt.Schema.PrioritizedPrimaryField.DBName
+	}
+
+	return repo, nil
+}
+
+func (p *Repo[T]) db(ctx context.Context) *gorm.DB {
+	return p.client.DB(ctx, p.runMode).Model(new(T))
+}
+
+// primaryKeyCond returns an unqualified equality on the primary key, which the sharding middleware can route.
+func (p *Repo[T]) primaryKeyCond(id any) (clause.Expression, error) {
+	if p.primaryKey == "" {
+		return nil, fmt.Errorf("model %T has no single primary key", *new(T))
+	}
+
+	return clause.Eq{Column: clause.Column{Name: p.primaryKey}, Value: id}, nil
+}
+
+// byPrimaryKey scopes db to the row whose primary key equals id and to conds, the first of which is the query and
+// the rest its arguments, as with [gorm.DB.Where].
+func (p *Repo[T]) byPrimaryKey(ctx context.Context, id any, conds []any) (*gorm.DB, error) {
+	pkCond, err := p.primaryKeyCond(id)
+	if err != nil {
+		return nil, err
+	}
+
+	db := p.db(ctx).Clauses(pkCond)
+	if len(conds) > 0 {
+		db = db.Where(conds[0], conds[1:]...)
+	}
+
+	return db, nil
+}
+
+// Get returns the row whose primary key equals id, or [ErrNotFound].
+func (p *Repo[T]) Get(ctx context.Context, id any, conds ...any) (*T, error) {
+	db, err := p.byPrimaryKey(ctx, id, conds)
+	if err != nil {
+		return nil, err
+	}
+
+	record := new(T)
+
+	err = db.Take(record).Error
+	if err != nil {
+		return nil, mapNotFound(err)
+	}
+
+	return record, nil
+}
+
+// FindWhere returns every row matching query and args, which follow the rules of [gorm.DB.Where].
+func (p *Repo[T]) FindWhere(ctx context.Context, query any, args ...any) ([]T, error) {
+	records := make([]T, 0)
+
+	err := p.db(ctx).Where(query, args...).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Create inserts record and fills its generated fields, such as an auto-increment primary key.
+func (p *Repo[T]) Create(ctx context.Context, record *T) error {
+	return p.db(ctx).Create(record).Error
+}
+
+// UpdateFields updates the given columns of the row whose primary key equals id and returns the number of affected
+// rows. Zero values in fields are written, unlike with struct-based updates.
+func (p *Repo[T]) UpdateFields(ctx context.Context, id any, fields map[string]any, conds ...any) (int64, error) {
+	db, err := p.byPrimaryKey(ctx, id, conds)
+	if err != nil {
+		return 0, err
+	}
+
+	retGorm := db.Updates(fields)
+	if retGorm.Error != nil {
+		return 0, retGorm.Error
+	}
+
+	return retGorm.RowsAffected, nil
+}
+
+// Delete removes the row whose primary key equals id and returns the number of affected rows.
+// Models with a [gorm.DeletedAt] field are soft-deleted.
+func (p *Repo[T]) Delete(ctx context.Context, id any, conds ...any) (int64, error) {
+	db, err := p.byPrimaryKey(ctx, id, conds)
+	if err != nil {
+		return 0, err
+	}
+
+	retGorm := db.Delete(new(T))
+	if retGorm.Error != nil {
+		return 0, retGorm.Error
+	}
+
+	return retGorm.RowsAffected, nil
+}
+
+// Count returns the number of rows matching query and args.
+func (p *Repo[T]) Count(ctx context.Context, query any, args ...any) (int64, error) {
+	var count int64
+
+	err := p.db(ctx).Where(query, args...).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Exists reports whether at least one row matches query and args without counting every match.
+func (p *Repo[T]) Exists(ctx context.Context, query any, args ...any) (bool, error) {
+	found := make([]int, 0, 1)
+
+	err := p.db(ctx).Select("1").Where(query, args...).Limit(1).Find(&found).Error
+	if err != nil {
+		return false, err
+	}
+
+	return len(found) > 0, nil
+}
+
+// mapNotFound replaces [gorm.ErrRecordNotFound] with [ErrNotFound] and returns other errors unchanged.
+func mapNotFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
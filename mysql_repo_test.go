@@ -0,0 +1,88 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type repoTestOrder struct {
+	Id        uint64
+	CreatedAt time.Time
+	Status    string
+}
+
+func TestRepoByPrimaryKey(t *testing.T) {
+	dialector := mysql.New(mysql.Config{
+		Conn:                      sql.OpenDB(rejectConnector{}),
+		SkipInitializeWithVersion: true,
+	})
+
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, SkipDefaultTransaction: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewRepo[repoTestOrder](&MysqlClient{db: db}, ReleaseMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		conds []any
+		want  string
+	}{
+		{name: "no conds", want: "WHERE `id` = ?"},
+		{
+			name:  "query and args",
+			conds: []any{"created_at = ?", createdAt},
+			want:  "WHERE `id` = ? AND created_at = ?",
+		},
+		{
+			name:  "map",
+			conds: []any{map[string]any{"created_at": createdAt}},
+			want:  "WHERE `id` = ? AND `repo_test_orders`.`created_at` = ?",
+		},
+		{
+			name:  "struct",
+			conds: []any{&repoTestOrder{CreatedAt: createdAt}},
+			want:  "WHERE `id` = ? AND `repo_test_orders`.`created_at` = ?",
+		},
+	}
+
+	terminals := map[string]func(tx *gorm.DB) *gorm.DB{
+		"Take": func(tx *gorm.DB) *gorm.DB {
+			return tx.Take(&repoTestOrder{})
+		},
+		"Updates": func(tx *gorm.DB) *gorm.DB {
+			return tx.Updates(map[string]any{"status": "paid"})
+		},
+		"Delete": func(tx *gorm.DB) *gorm.DB {
+			return tx.Delete(&repoTestOrder{})
+		},
+	}
+
+	for _, tt := range tests {
+		for name, terminal := range terminals {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				tx, err := repo.byPrimaryKey(context.Background(), 42, tt.conds)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				stmt := terminal(tx).Statement
+				if !strings.Contains(stmt.SQL.String(), tt.want) {
+					t.Errorf("SQL = %q, want it to contain %q", stmt.SQL.String(), tt.want)
+				}
+			})
+		}
+	}
+}
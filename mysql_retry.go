@@ -0,0 +1,175 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/choveylee/tlog"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	// mysqlErrLockWaitTimeout is ER_LOCK_WAIT_TIMEOUT.
+	mysqlErrLockWaitTimeout = 1205
+
+	// mysqlErrDeadlock is ER_LOCK_DEADLOCK.
+	mysqlErrDeadlock = 1213
+)
+
+// TransientMysqlError wraps a deadlock or lock-wait timeout reported by MySQL together with the statement that
+// was chosen as the victim. It unwraps to the original driver error.
+type TransientMysqlError struct {
+	// SQL is the statement, with placeholders, that failed with the transient error.
+	SQL string
+
+	err error
+}
+
+// Error implements error and returns the message of the wrapped driver error.
+func (p *TransientMysqlError) Error() string {
+	if p == nil || p.err == nil {
+		return "transient mysql error"
+	}
+
+	return p.err.Error()
+}
+
+// Unwrap returns the wrapped driver error.
+func (p *TransientMysqlError) Unwrap() error {
+	return p.err
+}
+
+// IsTransientMysqlError reports whether err is a MySQL deadlock (1213) or lock-wait timeout (1205),
+// which are safe to resolve by re-executing the whole transaction.
+func IsTransientMysqlError(err error) bool {
+	return transientMysqlErrorLabel(err) != ""
+}
+
+// transientMysqlErrorLabel returns the metric label of a transient MySQL error, or an empty string.
+func transientMysqlErrorLabel(err error) string {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return ""
+	}
+
+	switch mysqlErr.Number {
+	case mysqlErrDeadlock:
+		return "deadlock"
+	case mysqlErrLockWaitTimeout:
+		return "lock_wait_timeout"
+	default:
+		return ""
+	}
+}
+
+// markTransientError wraps a transient statement error in a [TransientMysqlError] carrying the victim SQL.
+func markTransientError(db *gorm.DB) {
+	if db.Error == nil || db.Statement.SQL.Len() == 0 || !IsTransientMysqlError(db.Error) {
+		return
+	}
+
+	var transientErr *TransientMysqlError
+	if errors.As(db.Error, &transientErr) {
+		return
+	}
+
+	db.Error = &TransientMysqlError{
+		SQL: db.Statement.SQL.String(),
+		err: db.Error,
+	}
+}
+
+// TxRetryPolicy re-executes a transaction started by [MysqlClient.WithTx] when it fails with a transient MySQL error.
+type TxRetryPolicy struct {
+	// MaxAttempts is the total number of executions, including the first. Values below 1 are treated as 1.
+	MaxAttempts int
+
+	// NewBackOff builds the wait schedule between attempts. A nil value uses a jittered exponential backoff
+	// starting at 50ms and capped at 1s.
+	NewBackOff func() backoff.BackOff
+
+	// OnRetry is invoked before each retry with the failed attempt number and its error. Use errors.As with
+	// [TransientMysqlError] to obtain the victim SQL. A nil value logs a warning that includes the victim SQL.
+	OnRetry func(ctx context.Context, attempt int, err error)
+}
+
+// NewTxRetryPolicy returns a [TxRetryPolicy] that runs a transaction at most maxAttempts times with the default backoff.
+func NewTxRetryPolicy(maxAttempts int) *TxRetryPolicy {
+	return &TxRetryPolicy{
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// WithRetry re-executes the transaction according to policy when it fails with a transient MySQL error.
+func WithRetry(policy *TxRetryPolicy) TxOption {
+	return func(cfg *txConfig) {
+		cfg.retryPolicy = policy
+	}
+}
+
+func newMysqlRetryBackOff() backoff.BackOff {
+	retryBackOff := backoff.NewExponentialBackOff()
+
+	retryBackOff.InitialInterval = 50 * time.Millisecond
+	retryBackOff.MaxInterval = time.Second
+	retryBackOff.MaxElapsedTime = 0
+
+	return retryBackOff
+}
+
+func (p *TxRetryPolicy) backOff() backoff.BackOff {
+	if p.NewBackOff != nil {
+		return p.NewBackOff()
+	}
+
+	return newMysqlRetryBackOff()
+}
+
+func (p *TxRetryPolicy) onRetry(ctx context.Context, attempt int, err error) {
+	if p.OnRetry != nil {
+		p.OnRetry(ctx, attempt, err)
+
+		return
+	}
+
+	event := tlog.W(ctx).Err(err)
+
+	var transientErr *TransientMysqlError
+	if errors.As(err, &transientErr) {
+		event = event.Detailf("sql:%s", transientErr.SQL)
+	}
+
+	event.Msgf("MySQL transaction attempt %d failed with a transient error and will be retried.", attempt)
+}
+
+// retry runs operation until it succeeds, fails with a non-transient error, exhausts MaxAttempts, or ctx is done.
+func (p *TxRetryPolicy) retry(ctx context.Context, operation func() error) error {
+	maxAttempts := max(p.MaxAttempts, 1)
+
+	attempt := 0
+
+	retryOperation := func() error {
+		attempt++
+
+		err := operation()
+		if err == nil {
+			return nil
+		}
+
+		errLabel := transientMysqlErrorLabel(err)
+		if errLabel == "" || attempt >= maxAttempts {
+			return backoff.Permanent(err)
+		}
+
+		MysqlTxRetryCounter.Inc(errLabel)
+
+		p.onRetry(ctx, attempt, err)
+
+		return err
+	}
+
+	return backoff.Retry(retryOperation, backoff.WithContext(p.backOff(), ctx))
+}
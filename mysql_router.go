@@ -0,0 +1,266 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// UnknownTenantError is returned by [MysqlRouter] when the tenant resolved from the context has no registered client.
+// Tenant is empty when the context carries no tenant at all.
+type UnknownTenantError struct {
+	Tenant string
+}
+
+// Error implements error.
+func (p *UnknownTenantError) Error() string {
+	if p.Tenant == "" {
+		return "no mysql tenant in context"
+	}
+
+	return fmt.Sprintf("unknown mysql tenant %q", p.Tenant)
+}
+
+// TenantResolver extracts the tenant of a request from ctx and reports whether one was found.
+type TenantResolver func(ctx context.Context) (string, bool)
+
+type tenantCtxKey struct{}
+
+// WithTenant returns a context carrying tenant for the default [TenantResolver] of [MysqlRouter].
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored by [WithTenant]. It is the default [TenantResolver].
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	tenant, ok := ctx.Value(tenantCtxKey{}).(string)
+
+	return tenant, ok && tenant != ""
+}
+
+// MysqlRouter routes sessions to one [MysqlClient] per tenant, selected by a [TenantResolver] from the context.
+// Its DB, Tx, WithTx, and WithTxContext methods mirror those of [MysqlClient], so code written against a single
+// client can switch to a router by changing the receiver.
+type MysqlRouter struct {
+	resolver TenantResolver
+
+	mu      sync.RWMutex
+	clients map[string]*MysqlClient
+
+	rejectOnce sync.Once
+	rejectDB   *gorm.DB
+	rejectErr  error
+}
+
+// NewMysqlRouter returns an empty router. A nil resolver defaults to [TenantFromContext].
+func NewMysqlRouter(resolver TenantResolver) *MysqlRouter {
+	if resolver == nil {
+		resolver = TenantFromContext
+	}
+
+	return &MysqlRouter{
+		resolver: resolver,
+
+		clients: make(map[string]*MysqlClient),
+	}
+}
+
+// Register opens a client for tenant with [NewMysqlClientWithOptions] and adds it to the router. The client's metric
+// label defaults to the tenant, so each tenant's pool is reported separately; a [WithClientName] in opts overrides it.
+func (p *MysqlRouter) Register(ctx context.Context, tenant, dsn string, opts ...MysqlOption) (*MysqlClient, error) {
+	tenantOpts := append([]MysqlOption{WithClientName(tenant)}, opts...)
+
+	client, err := NewMysqlClientWithOptions(ctx, dsn, tenantOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("open mysql tenant %q: %w", tenant, err)
+	}
+
+	err = p.Add(tenant, client)
+	if err != nil {
+		_ = client.Close(ctx)
+
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Add registers an existing client for tenant. It fails when the tenant is already registered.
+func (p *MysqlRouter) Add(tenant string, client *MysqlClient) error {
+	if tenant == "" {
+		return errors.New("mysql tenant must not be empty")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.clients[tenant]; ok {
+		return fmt.Errorf("mysql tenant %q already registered", tenant)
+	}
+
+	p.clients[tenant] = client
+
+	return nil
+}
+
+// Remove unregisters tenant and returns its client, or nil when it was not registered. The caller owns the returned
+// client and should close it once in-flight work has finished.
+func (p *MysqlRouter) Remove(tenant string) *MysqlClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client := p.clients[tenant]
+
+	delete(p.clients, tenant)
+
+	return client
+}
+
+// Client returns the client of the tenant resolved from ctx, or an [UnknownTenantError].
+func (p *MysqlRouter) Client(ctx context.Context) (*MysqlClient, error) {
+	tenant, ok := p.resolver(ctx)
+	if !ok {
+		return nil, &UnknownTenantError{}
+	}
+
+	p.mu.RLock()
+	client, ok := p.clients[tenant]
+	p.mu.RUnlock()
+
+	if !ok {
+		return nil, &UnknownTenantError{Tenant: tenant}
+	}
+
+	return client, nil
+}
+
+// DB returns [MysqlClient.DB] of the tenant resolved from ctx. For an unknown tenant, every statement on the returned
+// session fails with an [UnknownTenantError].
+func (p *MysqlRouter) DB(ctx context.Context, runMode string) *gorm.DB {
+	client, err := p.Client(ctx)
+	if err != nil {
+		return p.errorDB(ctx, err)
+	}
+
+	return client.DB(ctx, runMode)
+}
+
+// Tx returns [MysqlClient.Tx] of the tenant resolved from ctx. For an unknown tenant, the returned session carries an
+// [UnknownTenantError] and no transaction is started.
+func (p *MysqlRouter) Tx(ctx context.Context, runMode string) *gorm.DB {
+	client, err := p.Client(ctx)
+	if err != nil {
+		return p.errorDB(ctx, err)
+	}
+
+	return client.Tx(ctx, runMode)
+}
+
+// WithTx runs [MysqlClient.WithTx] on the client of the tenant resolved from ctx.
+func (p *MysqlRouter) WithTx(ctx context.Context, runMode string, fn func(tx *gorm.DB) error, opts ...TxOption) error {
+	client, err := p.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.WithTx(ctx, runMode, fn, opts...)
+}
+
+// WithTxContext runs [MysqlClient.WithTxContext] on the client of the tenant resolved from ctx.
+func (p *MysqlRouter) WithTxContext(ctx context.Context, runMode string, fn func(ctx context.Context) error,
+	opts ...TxOption) error {
+	client, err := p.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.WithTxContext(ctx, runMode, fn, opts...)
+}
+
+// Close closes every registered client with [MysqlClient.Close] and returns the joined errors.
+func (p *MysqlRouter) Close(ctx context.Context) error {
+	p.mu.RLock()
+	clients := make([]*MysqlClient, 0, len(p.clients))
+	for _, client := range p.clients {
+		clients = append(clients, client)
+	}
+	p.mu.RUnlock()
+
+	var err error
+
+	for _, client := range clients {
+		err = errors.Join(err, client.Close(ctx))
+	}
+
+	return err
+}
+
+// errorDB returns a session that fails every statement with err without touching any tenant's pool.
+func (p *MysqlRouter) errorDB(ctx context.Context, err error) *gorm.DB {
+	p.rejectOnce.Do(func() {
+		connPool := sql.OpenDB(rejectConnector{})
+
+		dialector := mysql.New(mysql.Config{
+			Conn:                      connPool,
+			SkipInitializeWithVersion: true,
+		})
+
+		p.rejectDB, p.rejectErr = gorm.Open(dialector, newRejectConfig())
+		if p.rejectErr != nil {
+			// Without a dialector Open only applies the config, so the fallback cannot fail. The dialector is set
+			// afterwards for building SQL but registers no callbacks, so no statement runs at all.
+			p.rejectDB, _ = gorm.Open(nil, newRejectConfig())
+
+			p.rejectDB.Dialector = dialector
+			p.rejectDB.ConnPool = connPool
+			p.rejectDB.Statement.ConnPool = connPool
+		}
+	})
+
+	db := p.rejectDB.WithContext(ctx)
+
+	db.Error = errors.Join(err, p.rejectErr)
+
+	return db
+}
+
+func newRejectConfig() *gorm.Config {
+	return &gorm.Config{
+		Logger: &dbLogger{
+			LogLevel: logger.Error,
+		},
+		DisableAutomaticPing: true,
+	}
+}
+
+// rejectConnector backs the pool of the sessions returned for unknown tenants. Those sessions carry an error, so
+// GORM never reaches the pool; if anything does, every connection attempt fails with errRejectConnPool, which
+// [sql.DB] reports from each call, including through the [sql.Row] of QueryRowContext.
+type rejectConnector struct{}
+
+var errRejectConnPool = errors.New("mysql tenant session has no connection")
+
+func (rejectConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errRejectConnPool
+}
+
+func (rejectConnector) Driver() driver.Driver {
+	return rejectDriver{}
+}
+
+type rejectDriver struct{}
+
+func (rejectDriver) Open(string) (driver.Conn, error) {
+	return nil, errRejectConnPool
+}
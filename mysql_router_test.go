@@ -0,0 +1,62 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMysqlRouterUnknownTenant(t *testing.T) {
+	router := NewMysqlRouter(nil)
+
+	ctx := WithTenant(context.Background(), "missing")
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "DB",
+			run: func() error {
+				var count int64
+
+				return router.DB(ctx, ReleaseMode).Table("orders").Count(&count).Error
+			},
+		},
+		{
+			name: "Tx",
+			run: func() error {
+				return router.Tx(ctx, ReleaseMode).Exec("DELETE FROM orders").Error
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unknownErr *UnknownTenantError
+
+			err := tt.run()
+			if !errors.As(err, &unknownErr) || unknownErr.Tenant != "missing" {
+				t.Errorf("error = %v, want UnknownTenantError for missing", err)
+			}
+		})
+	}
+}
+
+func TestMysqlRouterRejectPool(t *testing.T) {
+	router := NewMysqlRouter(nil)
+
+	connPool := router.DB(context.Background(), ReleaseMode).Statement.ConnPool
+
+	var value int
+
+	err := connPool.QueryRowContext(context.Background(), "SELECT 1").Scan(&value)
+	if !errors.Is(err, errRejectConnPool) {
+		t.Errorf("QueryRowContext().Scan() error = %v, want errRejectConnPool", err)
+	}
+
+	_, err = connPool.ExecContext(context.Background(), "DELETE FROM orders")
+	if !errors.Is(err, errRejectConnPool) {
+		t.Errorf("ExecContext() error = %v, want errRejectConnPool", err)
+	}
+}
@@ -0,0 +1,170 @@
+package tdb
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/choveylee/tlog"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	// defaultSlowThreshold is the latency above which a statement is treated as slow unless configured otherwise.
+	defaultSlowThreshold = 500 * time.Millisecond
+)
+
+// rateBudget limits events to a fixed number per window and counts the events it rejects.
+type rateBudget struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int64
+	suppressed  int64
+}
+
+// take consumes one unit of budget within the current window and reports whether the event is allowed.
+// When a new window starts, it also returns the number of events rejected during the previous window.
+func (p *rateBudget) take(budget int64, window time.Duration) (bool, int64) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var suppressed int64
+
+	if now.Sub(p.windowStart) >= window {
+		suppressed = p.suppressed
+
+		p.windowStart = now
+		p.used = 0
+		p.suppressed = 0
+	}
+
+	if p.used >= budget {
+		p.suppressed++
+
+		return false, suppressed
+	}
+
+	p.used++
+
+	return true, suppressed
+}
+
+// slowQueryLog holds the slow-query settings of one [MysqlClient]. It is shared by every copy of the client's
+// [dbLogger], so settings changed at runtime apply to sessions created earlier.
+type slowQueryLog struct {
+	threshold     atomic.Int64
+	level         atomic.Int32
+	budget        atomic.Int64
+	parameterized atomic.Bool
+	explainBudget atomic.Int64
+
+	logBudget   rateBudget
+	explainRate rateBudget
+}
+
+func newSlowQueryLog() *slowQueryLog {
+	slowLog := &slowQueryLog{}
+
+	slowLog.threshold.Store(int64(defaultSlowThreshold))
+	slowLog.level.Store(int32(logger.Warn))
+
+	return slowLog
+}
+
+// isSlow reports whether latency exceeds the configured threshold. A non-positive threshold disables detection.
+func (p *slowQueryLog) isSlow(latency time.Duration) bool {
+	threshold := time.Duration(p.threshold.Load())
+
+	return threshold > 0 && latency > threshold
+}
+
+// allow consumes one entry of the per-second budget and reports whether the slow query may be logged.
+// When a new one-second window starts, the number of entries suppressed in the previous window is logged once.
+func (p *slowQueryLog) allow(ctx context.Context) bool {
+	budget := p.budget.Load()
+	if budget <= 0 {
+		return true
+	}
+
+	allowed, suppressed := p.logBudget.take(budget, time.Second)
+	if suppressed > 0 {
+		p.event(ctx).Msgf("Suppressed %d slow SQL log entries in the previous second.", suppressed)
+	}
+
+	return allowed
+}
+
+// event returns a tlog event at the configured slow-query level.
+func (p *slowQueryLog) event(ctx context.Context) *tlog.Tevent {
+	switch logger.LogLevel(p.level.Load()) {
+	case logger.Error:
+		return tlog.E(ctx)
+	case logger.Info:
+		return tlog.I(ctx)
+	default:
+		return tlog.W(ctx)
+	}
+}
+
+// callerLocation returns file:line of the first stack frame outside GORM, its plugins, and this package.
+func callerLocation() string {
+	var pcs [32]uintptr
+
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+
+		if !isInternalFrame(frame.Function) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+// isInternalFrame reports whether function belongs to GORM, the OpenTelemetry plugin, or tdb itself.
+func isInternalFrame(function string) bool {
+	return strings.HasPrefix(function, "gorm.io/") ||
+		strings.HasPrefix(function, "github.com/uptrace/opentelemetry-go-extra/") ||
+		strings.HasPrefix(function, "github.com/choveylee/tdb.")
+}
+
+// slowQueryLog returns the slow-query settings shared by the client's loggers.
+func (p *MysqlClient) slowQueryLog() *slowQueryLog {
+	return p.db.Logger.(*dbLogger).slowLog
+}
+
+// SetSlowThreshold sets the latency above which statements are logged as slow and counted in [MysqlSlowQueryCounter].
+// A non-positive threshold disables slow-query detection. The default is 500ms.
+func (p *MysqlClient) SetSlowThreshold(threshold time.Duration) {
+	p.slowQueryLog().threshold.Store(int64(threshold))
+}
+
+// SetSlowLogLevel sets the level used for slow-query log entries. Only [logger.Info], [logger.Warn],
+// and [logger.Error] are meaningful; other values fall back to Warn. The default is Warn.
+func (p *MysqlClient) SetSlowLogLevel(level logger.LogLevel) {
+	p.slowQueryLog().level.Store(int32(level))
+}
+
+// SetSlowLogBudget limits slow-query log entries to perSecond per second; entries beyond the budget are counted
+// and summarized once per second instead of being logged. A non-positive value removes the limit, which is the default.
+// The budget does not affect [MysqlSlowQueryCounter].
+func (p *MysqlClient) SetSlowLogBudget(perSecond int) {
+	p.slowQueryLog().budget.Store(int64(perSecond))
+}
+
+// SetParameterizedQueries controls whether logged SQL keeps its placeholders instead of interpolating bound values,
+// which keeps literal data out of the logs. The default is false.
+func (p *MysqlClient) SetParameterizedQueries(parameterized bool) {
+	p.slowQueryLog().parameterized.Store(parameterized)
+}
@@ -0,0 +1,378 @@
+package tdb
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/longbridgeapp/sqlparser"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxStatementLabelCacheSize caps the number of distinct SQL strings whose metric labels are cached.
+	maxStatementLabelCacheSize = 4096
+
+	// maxStatementFingerprintCacheSize caps the number of distinct SQL strings whose fingerprints are cached.
+	maxStatementFingerprintCacheSize = 4096
+
+	statementFingerprintKey = "tdb:fingerprint"
+)
+
+// statementLabels is the table and operation derived from a SQL statement for metric labels.
+type statementLabels struct {
+	table     string
+	operation string
+}
+
+var (
+	statementLabelCache     sync.Map
+	statementLabelCacheSize atomic.Int64
+
+	statementFingerprintCache     sync.Map
+	statementFingerprintCacheSize atomic.Int64
+)
+
+// statementFingerprint is the fingerprint of a statement's SQL, kept on the statement for the hooks that need it.
+type statementFingerprint struct {
+	rawSql      string
+	fingerprint string
+}
+
+// metricLabels returns the table and operation labels of the statement executed by db. Statements built by GORM
+// use the model schema and the first build clause; raw SQL issued through Raw, Exec, or Row is parsed instead.
+func metricLabels(db *gorm.DB) (string, string, bool) {
+	if len(db.Statement.BuildClauses) > 0 {
+		if db.Statement.Schema != nil {
+			return db.Statement.Schema.Table, db.Statement.BuildClauses[0], true
+		}
+
+		if db.Statement.Table != "" {
+			return db.Statement.Table, db.Statement.BuildClauses[0], true
+		}
+	}
+
+	if db.Statement.SQL.Len() == 0 {
+		return "", "", false
+	}
+
+	labels := parseStatementLabels(db.Statement.SQL.String())
+
+	return labels.table, labels.operation, true
+}
+
+// parseStatementLabels derives metric labels from rawSql, caching results for repeated statements.
+func parseStatementLabels(rawSql string) statementLabels {
+	cached, ok := statementLabelCache.Load(rawSql)
+	if ok {
+		return cached.(statementLabels)
+	}
+
+	labels := statementLabels{
+		table:     sqlTableName(rawSql),
+		operation: sqlOperation(rawSql),
+	}
+
+	if statementLabelCacheSize.Load() < maxStatementLabelCacheSize {
+		_, loaded := statementLabelCache.LoadOrStore(rawSql, labels)
+		if !loaded {
+			statementLabelCacheSize.Add(1)
+		}
+	}
+
+	return labels
+}
+
+// fingerprintOf returns the fingerprint of the SQL executed by db, computing it at most once per statement.
+func fingerprintOf(db *gorm.DB) string {
+	rawSql := db.Statement.SQL.String()
+
+	if value, ok := db.InstanceGet(statementFingerprintKey); ok {
+		if cached, ok := value.(statementFingerprint); ok && cached.rawSql == rawSql {
+			return cached.fingerprint
+		}
+	}
+
+	fingerprint := parseStatementFingerprint(rawSql)
+
+	db.InstanceSet(statementFingerprintKey, statementFingerprint{
+		rawSql:      rawSql,
+		fingerprint: fingerprint,
+	})
+
+	return fingerprint
+}
+
+// parseStatementFingerprint returns the fingerprint of rawSql, caching results for repeated statements.
+func parseStatementFingerprint(rawSql string) string {
+	cached, ok := statementFingerprintCache.Load(rawSql)
+	if ok {
+		return cached.(string)
+	}
+
+	fingerprint := fingerprintSQL(rawSql)
+
+	if statementFingerprintCacheSize.Load() < maxStatementFingerprintCacheSize {
+		_, loaded := statementFingerprintCache.LoadOrStore(rawSql, fingerprint)
+		if !loaded {
+			statementFingerprintCacheSize.Add(1)
+		}
+	}
+
+	return fingerprint
+}
+
+// sqlOperation returns the upper-cased leading keyword of rawSql, such as SELECT or SHOW.
+func sqlOperation(rawSql string) string {
+	fields := strings.Fields(rawSql)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(strings.TrimLeft(fields[0], "("))
+}
+
+// sqlTableName returns the primary table of rawSql, or an empty string when the statement cannot be parsed.
+func sqlTableName(rawSql string) string {
+	stmt, err := sqlparser.NewParser(strings.NewReader(rawSql)).ParseStatement()
+	if err != nil {
+		return ""
+	}
+
+	switch stmt := stmt.(type) {
+	case *sqlparser.SelectStatement:
+		return sourceTableName(stmt.FromItems)
+	case *sqlparser.InsertStatement:
+		return tableName(stmt.TableName)
+	case *sqlparser.UpdateStatement:
+		return tableName(stmt.TableName)
+	case *sqlparser.DeleteStatement:
+		return tableName(stmt.TableName)
+	default:
+		return ""
+	}
+}
+
+// sourceTableName returns the left-most table referenced by a FROM source.
+func sourceTableName(src sqlparser.Source) string {
+	switch src := src.(type) {
+	case *sqlparser.TableName:
+		return tableName(src)
+	case *sqlparser.JoinClause:
+		return sourceTableName(src.X)
+	case *sqlparser.ParenSource:
+		return sourceTableName(src.X)
+	case *sqlparser.SelectStatement:
+		return sourceTableName(src.FromItems)
+	default:
+		return ""
+	}
+}
+
+func tableName(table *sqlparser.TableName) string {
+	if table == nil {
+		return ""
+	}
+
+	return sqlparser.IdentName(table.Name)
+}
+
+// sqlTableNames returns every table referenced by rawSql, including joins and subqueries, or nil when the statement
+// cannot be parsed.
+func sqlTableNames(rawSql string) []string {
+	stmt, err := sqlparser.NewParser(strings.NewReader(rawSql)).ParseStatement()
+	if err != nil {
+		return nil
+	}
+
+	collector := &tableNameCollector{}
+
+	err = sqlparser.Walk(collector, stmt)
+	if err != nil {
+		return nil
+	}
+
+	return collector.tables
+}
+
+// tableNameCollector gathers distinct table names while walking a statement.
+type tableNameCollector struct {
+	tables []string
+}
+
+func (p *tableNameCollector) Visit(node sqlparser.Node) (sqlparser.Visitor, error) {
+	if table, ok := node.(*sqlparser.TableName); ok {
+		name := tableName(table)
+		if name != "" && !slices.Contains(p.tables, name) {
+			p.tables = append(p.tables, name)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *tableNameCollector) VisitEnd(sqlparser.Node) error {
+	return nil
+}
+
+var (
+	// fingerprintList matches a parenthesized list of placeholders, such as an IN list or a VALUES row.
+	fingerprintList = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+
+	// fingerprintRows matches repeated collapsed VALUES rows.
+	fingerprintRows = regexp.MustCompile(`\(\?\+\)(?:\s*,\s*\(\?\+\))+`)
+)
+
+// fingerprintSQL reduces rawSql to its shape: comments are dropped, string, numeric, hexadecimal, and bit literals
+// become ?, lists of placeholders collapse to (?+), and whitespace is collapsed, so statements differing only in
+// their values or in the length of their IN lists share one fingerprint.
+func fingerprintSQL(rawSql string) string {
+	var builder strings.Builder
+
+	builder.Grow(len(rawSql))
+
+	// space records a pending separator; identifier records whether the last written byte continues an identifier.
+	space, identifier := false, false
+
+	write := func(s string) {
+		if space && builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+
+		space = false
+
+		builder.WriteString(s)
+	}
+
+	for i := 0; i < len(rawSql); {
+		c := rawSql[i]
+
+		switch {
+		case c == '/' && strings.HasPrefix(rawSql[i:], "/*"):
+			end := strings.Index(rawSql[i+2:], "*/")
+			if end < 0 {
+				i = len(rawSql)
+			} else {
+				i += end + 4
+			}
+
+			space, identifier = true, false
+		case c == '#' || (c == '-' && strings.HasPrefix(rawSql[i:], "-- ")):
+			end := strings.IndexByte(rawSql[i:], '\n')
+			if end < 0 {
+				i = len(rawSql)
+			} else {
+				i += end + 1
+			}
+
+			space, identifier = true, false
+		case c == '\'' || c == '"':
+			i = skipQuoted(rawSql, i)
+
+			write("?")
+
+			identifier = false
+		case strings.IndexByte("xXbBnN", c) >= 0 && !identifier && i+1 < len(rawSql) && rawSql[i+1] == '\'':
+			// Hexadecimal, bit, and national string literals such as X'4A', b'01', and N'abc'.
+			i = skipQuoted(rawSql, i+1)
+
+			write("?")
+
+			identifier = false
+		case c == '`':
+			end := strings.IndexByte(rawSql[i+1:], '`')
+			if end < 0 {
+				end = len(rawSql) - i - 1
+			}
+
+			write(rawSql[i:min(i+end+2, len(rawSql))])
+
+			i += end + 2
+			identifier = false
+		case (isDigit(c) || c == '.' && i+1 < len(rawSql) && isDigit(rawSql[i+1])) && !identifier:
+			i = skipNumber(rawSql, i)
+
+			write("?")
+
+			identifier = false
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+			space, identifier = true, false
+		default:
+			write(rawSql[i : i+1])
+
+			i++
+			identifier = isDigit(c) || c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+				c >= 0x80
+		}
+	}
+
+	fingerprint := fingerprintList.ReplaceAllString(builder.String(), "(?+)")
+
+	return fingerprintRows.ReplaceAllString(fingerprint, "(?+)")
+}
+
+// skipQuoted returns the index after the string literal starting at start, honoring backslash escapes and
+// doubled quotes.
+func skipQuoted(rawSql string, start int) int {
+	quote := rawSql[start]
+
+	for i := start + 1; i < len(rawSql); i++ {
+		switch rawSql[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(rawSql) && rawSql[i+1] == quote {
+				i++
+
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return len(rawSql)
+}
+
+// skipNumber returns the index after the numeric literal starting at start, including decimal, exponent, and
+// hexadecimal forms.
+func skipNumber(rawSql string, start int) int {
+	i := start
+
+	if strings.HasPrefix(rawSql[i:], "0x") || strings.HasPrefix(rawSql[i:], "0X") {
+		i += 2
+
+		for i < len(rawSql) && (isDigit(rawSql[i]) || rawSql[i] >= 'a' && rawSql[i] <= 'f' ||
+			rawSql[i] >= 'A' && rawSql[i] <= 'F') {
+			i++
+		}
+
+		return i
+	}
+
+	for i < len(rawSql) && (isDigit(rawSql[i]) || rawSql[i] == '.') {
+		i++
+	}
+
+	if i < len(rawSql) && (rawSql[i] == 'e' || rawSql[i] == 'E') {
+		i++
+
+		if i < len(rawSql) && (rawSql[i] == '+' || rawSql[i] == '-') {
+			i++
+		}
+
+		for i < len(rawSql) && isDigit(rawSql[i]) {
+			i++
+		}
+	}
+
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
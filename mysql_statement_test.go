@@ -0,0 +1,122 @@
+package tdb
+
+import (
+	"testing"
+)
+
+func TestFingerprintSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawSql string
+		want   string
+	}{
+		{
+			name:   "placeholders",
+			rawSql: "SELECT * FROM `orders` WHERE `user_id` = ? AND `status` = ?",
+			want:   "SELECT * FROM `orders` WHERE `user_id` = ? AND `status` = ?",
+		},
+		{
+			name:   "string literals",
+			rawSql: `SELECT * FROM t WHERE a = 'x' AND b = "y"`,
+			want:   "SELECT * FROM t WHERE a = ? AND b = ?",
+		},
+		{
+			name:   "doubled quotes",
+			rawSql: "SELECT * FROM t WHERE a = 'it''s' AND b = ''",
+			want:   "SELECT * FROM t WHERE a = ? AND b = ?",
+		},
+		{
+			name:   "backslash escapes",
+			rawSql: `SELECT * FROM t WHERE a = 'it\'s' AND b = "say \"hi\""`,
+			want:   "SELECT * FROM t WHERE a = ? AND b = ?",
+		},
+		{
+			name:   "numbers",
+			rawSql: "SELECT * FROM t WHERE a = 42 AND b = -1.5 AND c = 1.5e-3 AND d = .5",
+			want:   "SELECT * FROM t WHERE a = ? AND b = -? AND c = ? AND d = ?",
+		},
+		{
+			name:   "numbers after keywords",
+			rawSql: "SELECT 1 FROM t LIMIT 10 OFFSET 20",
+			want:   "SELECT ? FROM t LIMIT ? OFFSET ?",
+		},
+		{
+			name:   "digits inside identifiers",
+			rawSql: "SELECT c1 FROM t2 WHERE col_9 = 9",
+			want:   "SELECT c1 FROM t2 WHERE col_9 = ?",
+		},
+		{
+			name:   "hexadecimal and bit literals",
+			rawSql: "SELECT * FROM t WHERE a = 0x1F AND b = X'4A' AND c = b'0101' AND d = N'abc'",
+			want:   "SELECT * FROM t WHERE a = ? AND b = ? AND c = ? AND d = ?",
+		},
+		{
+			name:   "identifiers ending in a prefix letter",
+			rawSql: "SELECT * FROM tab WHERE ab='x'",
+			want:   "SELECT * FROM tab WHERE ab=?",
+		},
+		{
+			name:   "quoted identifiers",
+			rawSql: "SELECT `col 1`, `2nd` FROM `t` WHERE `x` = 5",
+			want:   "SELECT `col 1`, `2nd` FROM `t` WHERE `x` = ?",
+		},
+		{
+			name:   "optimizer hints and block comments",
+			rawSql: "SELECT /*+ MAX_EXECUTION_TIME(500) */ * FROM t /* trace:abc */ WHERE id = 1",
+			want:   "SELECT * FROM t WHERE id = ?",
+		},
+		{
+			name:   "line comments",
+			rawSql: "SELECT * FROM t -- by id\nWHERE id = 1 # trailing",
+			want:   "SELECT * FROM t WHERE id = ?",
+		},
+		{
+			name:   "in lists",
+			rawSql: "SELECT * FROM t WHERE id IN (1, 2, 3) AND k IN (?,?)",
+			want:   "SELECT * FROM t WHERE id IN (?+) AND k IN (?+)",
+		},
+		{
+			name:   "values rows",
+			rawSql: "INSERT INTO t (a,b) VALUES (1,'x'),(2,'y'), (3,'z')",
+			want:   "INSERT INTO t (a,b) VALUES (?+)",
+		},
+		{
+			name:   "whitespace",
+			rawSql: "  SELECT\t*\r\n  FROM   t\n",
+			want:   "SELECT * FROM t",
+		},
+		{
+			name:   "unterminated string",
+			rawSql: "SELECT * FROM t WHERE a = 'open",
+			want:   "SELECT * FROM t WHERE a = ?",
+		},
+		{
+			name:   "unterminated comment",
+			rawSql: "SELECT 1 /* open",
+			want:   "SELECT ?",
+		},
+		{
+			name:   "empty",
+			rawSql: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fingerprintSQL(tt.rawSql)
+			if got != tt.want {
+				t.Errorf("fingerprintSQL(%q) = %q, want %q", tt.rawSql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintSQLSharesShapes(t *testing.T) {
+	a := fingerprintSQL("SELECT * FROM t WHERE id IN (1,2) AND name = 'a'")
+	b := fingerprintSQL("SELECT  *  FROM t\nWHERE id IN (7, 8, 9) AND name = 'bcd'")
+
+	if a != b {
+		t.Errorf("fingerprints differ: %q and %q", a, b)
+	}
+}
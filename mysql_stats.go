@@ -0,0 +1,281 @@
+package tdb
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// queryStatsOverflow is the fingerprint that collects statements once MaxFingerprints is reached.
+	queryStatsOverflow = "<other>"
+
+	// Latency buckets grow by a factor of 2^(1/4) from 50µs, reaching about 90s at the last bucket, so a
+	// percentile is reported within 19% of its true value.
+	queryStatsMinLatency  = 50 * time.Microsecond
+	queryStatsBucketCount = 84
+	queryStatsBucketBase  = 1.189207115002721
+
+	defaultQueryStatsTopN = 20
+)
+
+// QueryStatsSettings configures the aggregator installed by [WithQueryStats]. Zero fields use the defaults
+// documented on each field.
+type QueryStatsSettings struct {
+	// MaxFingerprints bounds the distinct fingerprints tracked; further statements are aggregated under <other>.
+	// The default is 1000.
+	MaxFingerprints int
+}
+
+// QueryStat is the aggregate of one statement fingerprint in a [QueryStats] snapshot. Latencies are in milliseconds.
+type QueryStat struct {
+	Fingerprint string  `json:"fingerprint"`
+	Table       string  `json:"table"`
+	Operation   string  `json:"operation"`
+	Count       int64   `json:"count"`
+	Errors      int64   `json:"errors"`
+	Rows        int64   `json:"rows"`
+	TotalMs     float64 `json:"total_ms"`
+	MeanMs      float64 `json:"mean_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+	MaxMs       float64 `json:"max_ms"`
+}
+
+// queryStatEntry accumulates the statements of one fingerprint.
+type queryStatEntry struct {
+	mu sync.Mutex
+
+	table     string
+	operation string
+
+	count   int64
+	errors  int64
+	rows    int64
+	total   time.Duration
+	max     time.Duration
+	buckets [queryStatsBucketCount]int64
+}
+
+// QueryStats aggregates statement latency, rows, and errors per SQL fingerprint in process, complementing
+// [MysqlHistogram], whose labels stay limited to table and operation. It is installed with [WithQueryStats] and
+// returned by [MysqlClient.QueryStats]; as an [http.Handler] it serves the top fingerprints as JSON.
+type QueryStats struct {
+	maxFingerprints int
+
+	mu      sync.RWMutex
+	entries map[string]*queryStatEntry
+	since   time.Time
+}
+
+func newQueryStats(settings QueryStatsSettings) *QueryStats {
+	if settings.MaxFingerprints <= 0 {
+		settings.MaxFingerprints = 1000
+	}
+
+	return &QueryStats{
+		maxFingerprints: settings.MaxFingerprints,
+
+		entries: make(map[string]*queryStatEntry),
+		since:   time.Now(),
+	}
+}
+
+// record adds one statement to the aggregate of fingerprint.
+func (p *QueryStats) record(fingerprint, table, operation string, latency time.Duration, rows int64, failed bool) {
+	entry := p.entry(fingerprint, table, operation)
+
+	bucket := 0
+	if latency > queryStatsMinLatency {
+		bucket = min(int(math.Ceil(math.Log(float64(latency)/float64(queryStatsMinLatency))/
+			math.Log(queryStatsBucketBase))), queryStatsBucketCount-1)
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	entry.count++
+	entry.total += latency
+	entry.max = max(entry.max, latency)
+	entry.buckets[bucket]++
+
+	if rows > 0 {
+		entry.rows += rows
+	}
+
+	if failed {
+		entry.errors++
+	}
+}
+
+// entry returns the aggregate of fingerprint, creating it, or the overflow aggregate once the limit is reached.
+func (p *QueryStats) entry(fingerprint, table, operation string) *queryStatEntry {
+	p.mu.RLock()
+	entry, ok := p.entries[fingerprint]
+	p.mu.RUnlock()
+
+	if ok {
+		return entry
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok = p.entries[fingerprint]
+	if ok {
+		return entry
+	}
+
+	if len(p.entries) >= p.maxFingerprints {
+		fingerprint, table, operation = queryStatsOverflow, "", ""
+
+		entry, ok = p.entries[fingerprint]
+		if ok {
+			return entry
+		}
+	}
+
+	entry = &queryStatEntry{
+		table:     table,
+		operation: operation,
+	}
+
+	p.entries[fingerprint] = entry
+
+	return entry
+}
+
+// Snapshot returns the n fingerprints ranked highest by sortBy, which is one of total (the default), count, p99,
+// max, rows, or errors. A non-positive n returns every fingerprint.
+func (p *QueryStats) Snapshot(n int, sortBy string) []QueryStat {
+	p.mu.RLock()
+	stats := make([]QueryStat, 0, len(p.entries))
+	for fingerprint, entry := range p.entries {
+		stats = append(stats, entry.stat(fingerprint))
+	}
+	p.mu.RUnlock()
+
+	key := func(stat QueryStat) float64 {
+		switch sortBy {
+		case "count":
+			return float64(stat.Count)
+		case "p99":
+			return stat.P99Ms
+		case "max":
+			return stat.MaxMs
+		case "rows":
+			return float64(stat.Rows)
+		case "errors":
+			return float64(stat.Errors)
+		default:
+			return stat.TotalMs
+		}
+	}
+
+	slices.SortFunc(stats, func(a, b QueryStat) int {
+		return cmp.Or(cmp.Compare(key(b), key(a)), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+
+	return stats
+}
+
+// Reset discards every aggregate and restarts the collection period.
+func (p *QueryStats) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.entries = make(map[string]*queryStatEntry)
+	p.since = time.Now()
+}
+
+// ServeHTTP implements [http.Handler]. It responds with the collection start time and the [QueryStats.Snapshot]
+// selected by the limit (default 20) and sort query parameters.
+func (p *QueryStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit := defaultQueryStatsTopN
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+
+			return
+		}
+
+		limit = parsed
+	}
+
+	p.mu.RLock()
+	since := p.since
+	p.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Since   time.Time   `json:"since"`
+		Queries []QueryStat `json:"queries"`
+	}{
+		Since:   since,
+		Queries: p.Snapshot(limit, r.URL.Query().Get("sort")),
+	})
+}
+
+func (p *queryStatEntry) stat(fingerprint string) QueryStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stat := QueryStat{
+		Fingerprint: fingerprint,
+		Table:       p.table,
+		Operation:   p.operation,
+		Count:       p.count,
+		Errors:      p.errors,
+		Rows:        p.rows,
+		TotalMs:     durationMillis(p.total),
+		MaxMs:       durationMillis(p.max),
+	}
+
+	if p.count == 0 {
+		return stat
+	}
+
+	stat.MeanMs = stat.TotalMs / float64(p.count)
+
+	// The p99 is the upper bound of the bucket holding the 99th percentile, capped at the observed maximum. The last
+	// bucket is open-ended, so its bound is the maximum itself.
+	rank := int64(math.Ceil(float64(p.count) * 0.99))
+
+	var seen int64
+
+	for bucket, count := range p.buckets {
+		seen += count
+		if seen >= rank {
+			upper := p.max
+			if bucket < queryStatsBucketCount-1 {
+				upper = time.Duration(float64(queryStatsMinLatency) * math.Pow(queryStatsBucketBase, float64(bucket)))
+			}
+
+			stat.P99Ms = durationMillis(min(upper, p.max))
+
+			break
+		}
+	}
+
+	return stat
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// QueryStats returns the aggregator installed with [WithQueryStats], or nil.
+func (p *MysqlClient) QueryStats() *QueryStats {
+	return p.queryStats
+}
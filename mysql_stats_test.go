@@ -0,0 +1,212 @@
+package tdb
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryStatsP99(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies map[time.Duration]int
+		wantP99   time.Duration
+		wantMax   time.Duration
+	}{
+		{
+			name:      "below the first bucket",
+			latencies: map[time.Duration]int{10 * time.Microsecond: 5},
+			wantP99:   10 * time.Microsecond,
+			wantMax:   10 * time.Microsecond,
+		},
+		{
+			name:      "single latency",
+			latencies: map[time.Duration]int{3 * time.Millisecond: 1},
+			wantP99:   3 * time.Millisecond,
+			wantMax:   3 * time.Millisecond,
+		},
+		{
+			name:      "outlier beyond the percentile",
+			latencies: map[time.Duration]int{time.Millisecond: 99, time.Second: 1},
+			wantP99:   time.Millisecond,
+			wantMax:   time.Second,
+		},
+		{
+			name:      "outlier within the percentile",
+			latencies: map[time.Duration]int{time.Millisecond: 98, time.Second: 2},
+			wantP99:   time.Second,
+			wantMax:   time.Second,
+		},
+		{
+			name:      "beyond the last bucket",
+			latencies: map[time.Duration]int{10 * time.Minute: 3},
+			wantP99:   10 * time.Minute,
+			wantMax:   10 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := newQueryStats(QueryStatsSettings{})
+
+			for latency, count := range tt.latencies {
+				for i := 0; i < count; i++ {
+					stats.record("SELECT ?", "t", "SELECT", latency, 1, false)
+				}
+			}
+
+			stat := stats.Snapshot(0, "")[0]
+
+			// Bucket bounds grow by 2^(1/4), so the reported p99 is at most 19% above the true value.
+			p99 := durationMillis(tt.wantP99)
+			if stat.P99Ms < p99 || stat.P99Ms > p99*queryStatsBucketBase {
+				t.Errorf("P99Ms = %v, want within [%v, %v]", stat.P99Ms, p99, p99*queryStatsBucketBase)
+			}
+
+			if stat.MaxMs != durationMillis(tt.wantMax) {
+				t.Errorf("MaxMs = %v, want %v", stat.MaxMs, durationMillis(tt.wantMax))
+			}
+		})
+	}
+}
+
+func TestQueryStatsBucketBounds(t *testing.T) {
+	last := time.Duration(float64(queryStatsMinLatency) * math.Pow(queryStatsBucketBase, queryStatsBucketCount-1))
+	if last < 80*time.Second || last > 100*time.Second {
+		t.Errorf("last bucket bound = %v, want about 90s", last)
+	}
+}
+
+func TestQueryStatsRecord(t *testing.T) {
+	stats := newQueryStats(QueryStatsSettings{})
+
+	stats.record("SELECT ?", "orders", "SELECT", 2*time.Millisecond, 3, false)
+	stats.record("SELECT ?", "orders", "SELECT", 4*time.Millisecond, -1, true)
+
+	snapshot := stats.Snapshot(0, "")
+	if len(snapshot) != 1 {
+		t.Fatalf("len(Snapshot) = %d, want 1", len(snapshot))
+	}
+
+	want := QueryStat{
+		Fingerprint: "SELECT ?",
+		Table:       "orders",
+		Operation:   "SELECT",
+		Count:       2,
+		Errors:      1,
+		Rows:        3,
+		TotalMs:     6,
+		MeanMs:      3,
+		MaxMs:       4,
+	}
+
+	got := snapshot[0]
+	got.P99Ms = 0
+
+	if got != want {
+		t.Errorf("Snapshot()[0] = %+v, want %+v", got, want)
+	}
+}
+
+func TestQueryStatsOverflow(t *testing.T) {
+	stats := newQueryStats(QueryStatsSettings{MaxFingerprints: 2})
+
+	for _, fingerprint := range []string{"a", "b", "c", "d", "a"} {
+		stats.record(fingerprint, "t", "SELECT", time.Millisecond, 0, false)
+	}
+
+	counts := make(map[string]int64)
+	for _, stat := range stats.Snapshot(0, "") {
+		counts[stat.Fingerprint] = stat.Count
+	}
+
+	want := map[string]int64{"a": 2, "b": 1, queryStatsOverflow: 2}
+	if len(counts) != len(want) {
+		t.Fatalf("fingerprints = %v, want %v", counts, want)
+	}
+
+	for fingerprint, count := range want {
+		if counts[fingerprint] != count {
+			t.Errorf("count of %q = %d, want %d", fingerprint, counts[fingerprint], count)
+		}
+	}
+}
+
+func TestQueryStatsSnapshotOrder(t *testing.T) {
+	stats := newQueryStats(QueryStatsSettings{})
+
+	stats.record("slow", "t", "SELECT", time.Second, 0, false)
+	stats.record("frequent", "t", "SELECT", time.Millisecond, 0, true)
+	stats.record("frequent", "t", "SELECT", time.Millisecond, 0, true)
+	stats.record("frequent", "t", "SELECT", time.Millisecond, 0, false)
+	stats.record("tied", "t", "SELECT", time.Millisecond, 0, false)
+
+	tests := []struct {
+		sortBy string
+		n      int
+		want   []string
+	}{
+		{sortBy: "", want: []string{"slow", "frequent", "tied"}},
+		{sortBy: "count", want: []string{"frequent", "slow", "tied"}},
+		{sortBy: "errors", want: []string{"frequent", "slow", "tied"}},
+		{sortBy: "max", n: 2, want: []string{"slow", "frequent"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortBy, func(t *testing.T) {
+			snapshot := stats.Snapshot(tt.n, tt.sortBy)
+
+			got := make([]string, 0, len(snapshot))
+			for _, stat := range snapshot {
+				got = append(got, stat.Fingerprint)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Snapshot(%d, %q) = %v, want %v", tt.n, tt.sortBy, got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Snapshot(%d, %q) = %v, want %v", tt.n, tt.sortBy, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryStatsServeHTTP(t *testing.T) {
+	stats := newQueryStats(QueryStatsSettings{})
+
+	stats.record("a", "t", "SELECT", time.Millisecond, 0, false)
+	stats.record("b", "t", "SELECT", 2*time.Millisecond, 0, false)
+
+	recorder := httptest.NewRecorder()
+	stats.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?limit=1&sort=max", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Queries []QueryStat `json:"queries"`
+	}
+
+	err := json.Unmarshal(recorder.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Queries) != 1 || body.Queries[0].Fingerprint != "b" {
+		t.Errorf("queries = %+v, want only b", body.Queries)
+	}
+
+	recorder = httptest.NewRecorder()
+	stats.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?limit=x", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status for an invalid limit = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,314 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// mysqlErrQueryTimeout is ER_QUERY_TIMEOUT, raised when MAX_EXECUTION_TIME interrupts a SELECT.
+	mysqlErrQueryTimeout = 3024
+
+	statementTimeoutKey = "tdb:statement_timeout"
+)
+
+// statementTimeoutExemptCtxKey marks a context whose statements must not be bounded by the default timeout.
+type statementTimeoutExemptCtxKey struct{}
+
+// withoutStatementTimeout returns a context whose statements run without the client's default statement timeout,
+// such as the migration DDL run by [Migrator]. A deadline of ctx itself still applies.
+func withoutStatementTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, statementTimeoutExemptCtxKey{}, true)
+}
+
+// statementDeadline remembers the context a statement ran with before its default timeout was applied.
+type statementDeadline struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+// statementTimeout applies the client's default statement timeout and MAX_EXECUTION_TIME hints.
+type statementTimeout struct {
+	timeout time.Duration
+	hints   bool
+}
+
+// register wires the timeout callbacks around every GORM statement processor.
+func (p *statementTimeout) register(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Query().Before("gorm:query").Register("tdb:timeout_before_query", p.beforeRead),
+		db.Callback().Row().Before("gorm:row").Register("tdb:timeout_before_row", p.beforeRow),
+		db.Callback().Raw().Before("gorm:raw").Register("tdb:timeout_before_raw", p.before),
+		db.Callback().Create().Before("gorm:create").Register("tdb:timeout_before_create", p.before),
+		db.Callback().Update().Before("gorm:update").Register("tdb:timeout_before_update", p.before),
+		db.Callback().Delete().Before("gorm:delete").Register("tdb:timeout_before_delete", p.before),
+		db.Callback().Query().After("gorm:query").Register("tdb:timeout_after_query", p.after),
+		db.Callback().Row().After("gorm:row").Register("tdb:timeout_after_row", p.afterRow),
+		db.Callback().Raw().After("gorm:raw").Register("tdb:timeout_after_raw", p.after),
+		db.Callback().Create().After("gorm:create").Register("tdb:timeout_after_create", p.after),
+		db.Callback().Update().After("gorm:update").Register("tdb:timeout_after_update", p.after),
+		db.Callback().Delete().After("gorm:delete").Register("tdb:timeout_after_delete", p.after),
+	)
+}
+
+// before bounds a statement whose context has no deadline by the default timeout, unless the context is exempt.
+func (p *statementTimeout) before(db *gorm.DB) {
+	if db.Error != nil || p.timeout <= 0 {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		return
+	}
+
+	if exempt, _ := ctx.Value(statementTimeoutExemptCtxKey{}).(bool); exempt {
+		return
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, p.timeout)
+
+	db.Statement.Context = timeoutCtx
+
+	db.Set(statementTimeoutKey, &statementDeadline{
+		parent: ctx,
+		cancel: cancel,
+	})
+}
+
+// executionTimeHint is the MAX_EXECUTION_TIME hint, in milliseconds, added after SELECT. Its type tells it apart
+// from a hint set by the caller, so that a statement executed again gets a hint for its new deadline.
+type executionTimeHint int64
+
+// Build implements [clause.Expression].
+func (p executionTimeHint) Build(builder clause.Builder) {
+	builder.WriteString(p.String())
+}
+
+func (p executionTimeHint) String() string {
+	return fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */", int64(p))
+}
+
+// beforeRead applies the default timeout and adds a MAX_EXECUTION_TIME hint derived from the remaining deadline
+// to SELECT statements, so the server abandons them when the caller stops waiting.
+func (p *statementTimeout) beforeRead(db *gorm.DB) {
+	p.before(db)
+
+	if db.Error != nil || !p.hints {
+		return
+	}
+
+	var hint executionTimeHint
+
+	if ctx := db.Statement.Context; ctx != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); remaining > 0 {
+				hint = executionTimeHint(executionTimeHintMillis(remaining))
+			}
+		}
+	}
+
+	stmt := db.Statement
+
+	if stmt.SQL.Len() == 0 {
+		setExecutionTimeHint(stmt, hint)
+
+		return
+	}
+
+	rawSql := stmt.SQL.String()
+	if hint == 0 || !isSelectSQL(rawSql) || strings.Contains(strings.ToUpper(rawSql), "MAX_EXECUTION_TIME") {
+		return
+	}
+
+	selectEnd := len(rawSql) - len(strings.TrimLeft(rawSql, " \t\r\n")) + len("select")
+
+	stmt.SQL.Reset()
+	stmt.SQL.WriteString(rawSql[:selectEnd] + " " + hint.String() + rawSql[selectEnd:])
+}
+
+// setExecutionTimeHint places hint after SELECT, replacing the hint of an earlier execution of a reused statement,
+// or removes that hint when hint is zero. A hint set by the caller is kept.
+func setExecutionTimeHint(stmt *gorm.Statement, hint executionTimeHint) {
+	selectClause := stmt.Clauses["SELECT"]
+
+	_, hinted := selectClause.AfterNameExpression.(executionTimeHint)
+	if selectClause.AfterNameExpression != nil && !hinted {
+		return
+	}
+
+	if hint == 0 {
+		if hinted {
+			selectClause.AfterNameExpression = nil
+
+			stmt.Clauses["SELECT"] = selectClause
+		}
+
+		return
+	}
+
+	selectClause.Name = "SELECT"
+	selectClause.AfterNameExpression = hint
+
+	stmt.Clauses["SELECT"] = selectClause
+}
+
+// after cancels the default timeout and restores the caller's context, so that a reused statement does not
+// inherit an expired deadline.
+func (p *statementTimeout) after(db *gorm.DB) {
+	deadline, ok := takeStatementDeadline(db)
+	if !ok {
+		return
+	}
+
+	deadline.cancel()
+
+	db.Statement.Context = deadline.parent
+}
+
+// beforeRow is beforeRead for Row and Rows, whose results are read after the callbacks finish. The default timeout
+// keeps bounding the reading, and is released as soon as the rows are closed; see [rowsContext].
+func (p *statementTimeout) beforeRow(db *gorm.DB) {
+	p.beforeRead(db)
+
+	value, ok := db.Get(statementTimeoutKey)
+	if !ok {
+		return
+	}
+
+	if deadline, ok := value.(*statementDeadline); ok {
+		db.Statement.Context = newRowsContext(db.Statement.Context, deadline.cancel)
+	}
+}
+
+// afterRow restores the caller's context but leaves the default timeout running for the returned rows, unless the
+// statement failed and no rows are left to read.
+func (p *statementTimeout) afterRow(db *gorm.DB) {
+	deadline, ok := takeStatementDeadline(db)
+	if !ok {
+		return
+	}
+
+	failed := db.Error != nil
+	if row, ok := db.Statement.Dest.(*sql.Row); ok && row.Err() != nil {
+		failed = true
+	}
+
+	if failed {
+		deadline.cancel()
+	}
+
+	db.Statement.Context = deadline.parent
+}
+
+// rowsContext carries the default timeout of a Row or Rows statement. database/sql derives the context of the rows
+// it returns with context.WithCancel, which registers with a parent that has an AfterFunc method through that method
+// and stops the registration when the rows are closed. rowsContext takes the stop as the end of the statement and
+// cancels the timeout, releasing its timer instead of holding it until it fires.
+type rowsContext struct {
+	context.Context
+
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+func newRowsContext(timeoutCtx context.Context, cancel context.CancelFunc) *rowsContext {
+	ctx := &rowsContext{
+		Context: timeoutCtx,
+
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	// A Done channel of its own keeps derived contexts from attaching to the timeout context directly.
+	context.AfterFunc(timeoutCtx, func() {
+		close(ctx.done)
+	})
+
+	return ctx
+}
+
+func (p *rowsContext) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *rowsContext) Err() error {
+	select {
+	case <-p.done:
+		return p.Context.Err()
+	default:
+		return nil
+	}
+}
+
+// AfterFunc runs f once the timeout ends. Its stop function cancels the timeout after unregistering f.
+func (p *rowsContext) AfterFunc(f func()) func() bool {
+	stop := context.AfterFunc(p.Context, func() {
+		// Err reports the end of the timeout only once Done is closed.
+		<-p.done
+
+		f()
+	})
+
+	return func() bool {
+		stopped := stop()
+
+		p.cancel()
+
+		return stopped
+	}
+}
+
+func takeStatementDeadline(db *gorm.DB) (*statementDeadline, bool) {
+	value, ok := db.Get(statementTimeoutKey)
+	if !ok {
+		return nil, false
+	}
+
+	db.Statement.Settings.Delete(statementTimeoutKey)
+
+	deadline, ok := value.(*statementDeadline)
+
+	return deadline, ok
+}
+
+// executionTimeHintMillis rounds remaining up to 100ms steps below one second, to whole seconds below ten seconds,
+// and to ten-second steps beyond, so that hinted statements share a bounded set of SQL texts and prepared statements.
+func executionTimeHintMillis(remaining time.Duration) int64 {
+	millis := remaining.Milliseconds() + 1
+
+	step := int64(10000)
+
+	switch {
+	case millis <= 1000:
+		step = 100
+	case millis <= 10000:
+		step = 1000
+	}
+
+	return (millis + step - 1) / step * step
+}
+
+// isStatementTimeout reports whether err means a statement ran out of time, either at the client deadline or at
+// the server's MAX_EXECUTION_TIME limit.
+func isStatementTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var mysqlErr *mysqldriver.MySQLError
+
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrQueryTimeout
+}
@@ -0,0 +1,170 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestExecutionTimeHintMillis(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      int64
+	}{
+		{remaining: 0, want: 100},
+		{remaining: time.Millisecond, want: 100},
+		{remaining: 99 * time.Millisecond, want: 100},
+		{remaining: 100 * time.Millisecond, want: 200},
+		{remaining: 999 * time.Millisecond, want: 1000},
+		{remaining: time.Second, want: 2000},
+		{remaining: 9999 * time.Millisecond, want: 10000},
+		{remaining: 10 * time.Second, want: 20000},
+		{remaining: 25 * time.Second, want: 30000},
+		{remaining: time.Minute, want: 70000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remaining.String(), func(t *testing.T) {
+			got := executionTimeHintMillis(tt.remaining)
+			if got != tt.want {
+				t.Errorf("executionTimeHintMillis(%v) = %d, want %d", tt.remaining, got, tt.want)
+			}
+
+			if time.Duration(got)*time.Millisecond <= tt.remaining {
+				t.Errorf("executionTimeHintMillis(%v) = %d, want more than the remaining time", tt.remaining, got)
+			}
+		})
+	}
+}
+
+func TestExecutionTimeHintString(t *testing.T) {
+	got := executionTimeHint(1500).String()
+	if got != "/*+ MAX_EXECUTION_TIME(1500) */" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestSetExecutionTimeHint(t *testing.T) {
+	callerHint := &clause.Expr{SQL: "/*+ MAX_EXECUTION_TIME(50) */"}
+
+	tests := []struct {
+		name    string
+		current clause.Expression
+		hint    executionTimeHint
+		want    clause.Expression
+	}{
+		{name: "adds", hint: 500, want: executionTimeHint(500)},
+		{name: "replaces a stale hint", current: executionTimeHint(2000), hint: 500, want: executionTimeHint(500)},
+		{name: "removes a stale hint", current: executionTimeHint(2000), hint: 0, want: nil},
+		{name: "keeps the caller's expression", current: callerHint, hint: 500, want: callerHint},
+		{name: "keeps the caller's expression without a deadline", current: callerHint, hint: 0, want: callerHint},
+		{name: "nothing to do", hint: 0, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := &gorm.Statement{Clauses: map[string]clause.Clause{}}
+			if tt.current != nil {
+				stmt.Clauses["SELECT"] = clause.Clause{Name: "SELECT", AfterNameExpression: tt.current}
+			}
+
+			setExecutionTimeHint(stmt, tt.hint)
+
+			got := stmt.Clauses["SELECT"].AfterNameExpression
+			if got != tt.want {
+				t.Errorf("AfterNameExpression = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementTimeoutExempt(t *testing.T) {
+	timeout := &statementTimeout{timeout: time.Second}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantDeadline bool
+	}{
+		{name: "bounded", ctx: context.Background(), wantDeadline: true},
+		{name: "exempt", ctx: withoutStatementTimeout(context.Background()), wantDeadline: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &gorm.DB{Statement: &gorm.Statement{Context: tt.ctx}}
+
+			timeout.before(db)
+
+			_, ok := db.Statement.Context.Deadline()
+			if ok != tt.wantDeadline {
+				t.Errorf("deadline set = %v, want %v", ok, tt.wantDeadline)
+			}
+
+			timeout.after(db)
+
+			if db.Statement.Context != tt.ctx {
+				t.Error("after() did not restore the caller's context")
+			}
+		})
+	}
+}
+
+func TestRowsContext(t *testing.T) {
+	t.Run("closing derived context releases the timeout", func(t *testing.T) {
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		ctx := newRowsContext(timeoutCtx, cancel)
+
+		// database/sql derives the context of returned rows like this and cancels it when they are closed.
+		rowsCtx, closeRows := context.WithCancel(ctx)
+		if rowsCtx.Err() != nil {
+			t.Fatalf("rows context Err() = %v before closing", rowsCtx.Err())
+		}
+
+		closeRows()
+
+		if !errors.Is(timeoutCtx.Err(), context.Canceled) {
+			t.Errorf("timeout Err() = %v, want context.Canceled", timeoutCtx.Err())
+		}
+
+		<-ctx.Done()
+	})
+
+	t.Run("expiry reaches derived contexts", func(t *testing.T) {
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		ctx := newRowsContext(timeoutCtx, cancel)
+
+		rowsCtx, closeRows := context.WithCancel(ctx)
+		defer closeRows()
+
+		<-rowsCtx.Done()
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) || !errors.Is(rowsCtx.Err(), context.DeadlineExceeded) {
+			t.Errorf("Err() = %v and %v, want context.DeadlineExceeded", ctx.Err(), rowsCtx.Err())
+		}
+	})
+
+	t.Run("keeps the deadline and values", func(t *testing.T) {
+		parent := withoutStatementTimeout(context.Background())
+
+		timeoutCtx, cancel := context.WithTimeout(parent, time.Hour)
+		defer cancel()
+
+		ctx := newRowsContext(timeoutCtx, cancel)
+
+		deadline, ok := ctx.Deadline()
+		wantDeadline, _ := timeoutCtx.Deadline()
+
+		if !ok || !deadline.Equal(wantDeadline) {
+			t.Errorf("Deadline() = %v, %v, want %v", deadline, ok, wantDeadline)
+		}
+
+		if ctx.Value(statementTimeoutExemptCtxKey{}) != true {
+			t.Error("Value() lost the parent's value")
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package tdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	txStatusCommitted    = "COMMITTED"
+	txStatusRolledBack   = "ROLLED_BACK"
+	txStatusPanicked     = "PANICKED"
+	txStatusCommitFailed = "COMMIT_FAILED"
+	txStatusBeginFailed  = "BEGIN_FAILED"
+)
+
+// txConfig collects the settings applied by [TxOption] values.
+type txConfig struct {
+	txOptions sql.TxOptions
+
+	retryPolicy *TxRetryPolicy
+}
+
+// TxOption customizes a transaction started by [MysqlClient.WithTx].
+type TxOption func(*txConfig)
+
+// WithIsolationLevel sets the isolation level of the transaction.
+func WithIsolationLevel(level sql.IsolationLevel) TxOption {
+	return func(cfg *txConfig) {
+		cfg.txOptions.Isolation = level
+	}
+}
+
+// WithReadOnly starts the transaction in read-only mode.
+func WithReadOnly() TxOption {
+	return func(cfg *txConfig) {
+		cfg.txOptions.ReadOnly = true
+	}
+}
+
+// txCtxKey scopes the ambient transaction stored in a context to the client that started it.
+type txCtxKey struct {
+	client *MysqlClient
+}
+
+// ambientTx is the transaction propagated through the context by [MysqlClient.WithTx].
+type ambientTx struct {
+	db *gorm.DB
+
+	savepoints atomic.Uint64
+
+	commitMu    sync.Mutex
+	afterCommit []func()
+}
+
+// onCommit registers fn to run after the transaction commits. It is not run when the transaction rolls back.
+func (p *ambientTx) onCommit(fn func()) {
+	p.commitMu.Lock()
+	defer p.commitMu.Unlock()
+
+	p.afterCommit = append(p.afterCommit, fn)
+}
+
+// committed runs the functions registered with onCommit.
+func (p *ambientTx) committed() {
+	p.commitMu.Lock()
+	afterCommit := p.afterCommit
+	p.afterCommit = nil
+	p.commitMu.Unlock()
+
+	for _, fn := range afterCommit {
+		fn()
+	}
+}
+
+// ambientTx returns the transaction this client started higher up the call stack of ctx, or nil.
+func (p *MysqlClient) ambientTx(ctx context.Context) *ambientTx {
+	if ctx == nil {
+		return nil
+	}
+
+	tx, _ := ctx.Value(txCtxKey{client: p}).(*ambientTx)
+
+	return tx
+}
+
+// session returns the transactional session bound to ctx, with Debug logging enabled for [DebugMode].
+func (p *ambientTx) session(ctx context.Context, runMode string) *gorm.DB {
+	if runMode == DebugMode {
+		return p.db.WithContext(ctx).Debug()
+	}
+
+	return p.db.WithContext(ctx)
+}
+
+// withSavepoint runs fn inside a SAVEPOINT of the ambient transaction, rolling back to it on error or panic.
+func (p *ambientTx) withSavepoint(ctx context.Context, runMode string, fn func(tx *gorm.DB) error) (err error) {
+	name := "tdb_sp_" + strconv.FormatUint(p.savepoints.Add(1), 10)
+
+	tx := p.session(ctx, runMode)
+
+	err = p.session(ctx, runMode).SavePoint(name).Error
+	if err != nil {
+		return fmt.Errorf("create mysql savepoint %s: %w", name, err)
+	}
+
+	panicked := true
+
+	defer func() {
+		if !panicked {
+			return
+		}
+
+		recovered := recover()
+
+		_ = p.session(ctx, runMode).RollbackTo(name).Error
+
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	err = fn(tx)
+
+	panicked = false
+
+	if err != nil {
+		rollbackErr := p.session(ctx, runMode).RollbackTo(name).Error
+		if rollbackErr != nil {
+			err = errors.Join(err, fmt.Errorf("rollback to mysql savepoint %s: %w", name, rollbackErr))
+		}
+
+		return err
+	}
+
+	err = p.session(ctx, runMode).Exec("RELEASE SAVEPOINT " + name).Error
+	if err != nil {
+		return fmt.Errorf("release mysql savepoint %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// WithTx runs fn inside a transaction. The transaction is committed when fn returns nil and rolled back when fn
+// returns an error or panics; a panic is re-raised after the rollback. The duration and outcome of every
+// transaction are recorded in [MysqlTxHistogram].
+//
+// The transaction is stored in the context of the session passed to fn, so [MysqlClient.DB] called with that
+// context joins it. When ctx already carries a transaction of this client, fn runs inside a SAVEPOINT of that
+// transaction instead of a new one; opts are ignored and the savepoint is not recorded in [MysqlTxHistogram].
+//
+// With [WithRetry], the whole transaction, including fn, is re-executed when it fails with a transient MySQL
+// error such as a deadlock. Savepoints are never retried on their own; the outermost transaction retries instead.
+// After [MysqlClient.Close], starting a new transaction fails with [ErrClientClosed].
+func (p *MysqlClient) WithTx(ctx context.Context, runMode string, fn func(tx *gorm.DB) error, opts ...TxOption) error {
+	if ambient := p.ambientTx(ctx); ambient != nil {
+		return ambient.withSavepoint(ctx, runMode, fn)
+	}
+
+	if p.closed.Load() {
+		return ErrClientClosed
+	}
+
+	cfg := &txConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.retryPolicy != nil {
+		return cfg.retryPolicy.retry(ctx, func() error {
+			return p.runTx(ctx, runMode, fn, &cfg.txOptions)
+		})
+	}
+
+	return p.runTx(ctx, runMode, fn, &cfg.txOptions)
+}
+
+// runTx executes fn in a single new transaction, storing the transaction in the context of the session passed to fn.
+func (p *MysqlClient) runTx(ctx context.Context, runMode string, fn func(tx *gorm.DB) error, txOptions *sql.TxOptions) (err error) {
+	startTime := time.Now()
+
+	if breaker := p.circuitBreaker(); breaker != nil && breaker.rejects() {
+		observeTx(startTime, txStatusBeginFailed)
+
+		return fmt.Errorf("begin mysql transaction: %w", ErrCircuitOpen)
+	}
+
+	tx := p.DB(ctx, runMode).Begin(txOptions)
+	if tx.Error != nil {
+		observeTx(startTime, txStatusBeginFailed)
+
+		return fmt.Errorf("begin mysql transaction: %w", tx.Error)
+	}
+
+	ambient := &ambientTx{}
+
+	tx = tx.WithContext(context.WithValue(ctx, txCtxKey{client: p}, ambient))
+
+	ambient.db = tx
+
+	panicked := true
+
+	defer func() {
+		if !panicked {
+			return
+		}
+
+		recovered := recover()
+
+		_ = tx.Rollback().Error
+
+		observeTx(startTime, txStatusPanicked)
+
+		// recovered is nil when fn exited through runtime.Goexit, which must keep unwinding without a new panic.
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	err = fn(tx)
+
+	panicked = false
+
+	if err != nil {
+		rollbackErr := tx.Rollback().Error
+		if rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			err = errors.Join(err, fmt.Errorf("rollback mysql transaction: %w", rollbackErr))
+		}
+
+		observeTx(startTime, txStatusRolledBack)
+
+		return err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		observeTx(startTime, txStatusCommitFailed)
+
+		return fmt.Errorf("commit mysql transaction: %w", err)
+	}
+
+	observeTx(startTime, txStatusCommitted)
+
+	ambient.committed()
+
+	return nil
+}
+
+// WithTxContext behaves like [MysqlClient.WithTx] but hands fn a context carrying the transaction instead of the
+// session itself. Repository code that calls [MysqlClient.DB] with that context joins the transaction, and nested
+// WithTx or WithTxContext calls create savepoints.
+func (p *MysqlClient) WithTxContext(ctx context.Context, runMode string, fn func(ctx context.Context) error, opts ...TxOption) error {
+	return p.WithTx(ctx, runMode, func(tx *gorm.DB) error {
+		return fn(tx.Statement.Context)
+	}, opts...)
+}
+
+// observeTx records the elapsed transaction time into [MysqlTxHistogram].
+func observeTx(startTime time.Time, txStatus string) {
+	MysqlTxHistogram.Observe(float64(time.Since(startTime).Milliseconds()), txStatus)
+}
@@ -0,0 +1,277 @@
+package tdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	defaultBulkUpsertMaxRows  = 1000
+	defaultBulkUpsertMaxBytes = 4 << 20
+
+	// bulkUpsertOperation labels upsert chunks in [MysqlHistogram] instead of the generic INSERT clause.
+	bulkUpsertOperation = "BULK_UPSERT"
+
+	metricOperationKey = "metric_operation"
+)
+
+// BulkUpsertOptions tunes [MysqlClient.BulkUpsert]. The zero value uses the defaults documented on each field.
+type BulkUpsertOptions struct {
+	// MaxRows caps the number of rows per INSERT statement. The default is 1000.
+	MaxRows int
+
+	// MaxBytes caps the estimated size of the bound values of one statement, keeping it below max_allowed_packet.
+	// The default is 4 MiB. A single row larger than MaxBytes is still sent in a chunk of its own.
+	MaxBytes int
+
+	// InTransaction runs every chunk inside one transaction, so either all rows are written or none.
+	InTransaction bool
+
+	// RunMode is passed to [MysqlClient.DB]. The default is [ReleaseMode].
+	RunMode string
+}
+
+// BulkUpsertResult summarizes a [MysqlClient.BulkUpsert] call.
+//
+// MySQL reports one affected row per inserted row, two per updated row, and none per row left unchanged.
+// Inserted, Updated, and Unchanged are derived from those counts per chunk; they are exact unless a chunk mixes
+// updated and unchanged rows, in which case the ambiguity is resolved in favor of inserts.
+type BulkUpsertResult struct {
+	Chunks int
+
+	Affected  int64
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+}
+
+// add accumulates the counts of one chunk of rowCount rows that affected affected rows.
+func (p *BulkUpsertResult) add(rowCount, affected int64) {
+	updated := max(affected-rowCount, 0)
+	inserted := affected - 2*updated
+
+	p.Chunks++
+	p.Affected += affected
+	p.Inserted += inserted
+	p.Updated += updated
+	p.Unchanged += rowCount - inserted - updated
+}
+
+// BulkUpsert inserts rows, a slice or pointer to a slice of models, with INSERT ... ON DUPLICATE KEY UPDATE.
+// Rows are split into chunks by both row count and estimated byte size. Rows that collide with an existing unique key
+// have updateColumns overwritten with the incoming values; with no updateColumns, existing rows are left untouched.
+//
+// MySQL cannot target the conflict: a row colliding with the primary key or with any unique index is updated.
+// conflictColumns therefore do not change the statement; when given, they must be the primary key or a unique index
+// declared on the model, which guards the key the caller expects against model changes.
+//
+// Each chunk's latency is recorded in [MysqlHistogram] under the BULK_UPSERT operation. Without
+// [BulkUpsertOptions.InTransaction], chunks written before a failure stay committed and are reflected in the
+// returned result.
+func (p *MysqlClient) BulkUpsert(ctx context.Context, rows any, conflictColumns []string, updateColumns []string,
+	opts *BulkUpsertOptions) (*BulkUpsertResult, error) {
+	options := BulkUpsertOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.MaxRows <= 0 {
+		options.MaxRows = defaultBulkUpsertMaxRows
+	}
+
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = defaultBulkUpsertMaxBytes
+	}
+
+	if options.RunMode == "" {
+		options.RunMode = ReleaseMode
+	}
+
+	rowsValue := reflect.Indirect(reflect.ValueOf(rows))
+	if rowsValue.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("bulk upsert rows must be a slice, got %T", rows)
+	}
+
+	result := &BulkUpsertResult{}
+
+	if rowsValue.Len() == 0 {
+		return result, nil
+	}
+
+	stmt := &gorm.Statement{DB: p.db}
+
+	err := stmt.Parse(rowsValue.Index(0).Interface())
+	if err != nil {
+		return nil, fmt.Errorf("parse bulk upsert model: %w", err)
+	}
+
+	if len(conflictColumns) > 0 && !isUniqueKey(stmt.Schema, conflictColumns) {
+		return nil, fmt.Errorf("bulk upsert conflict columns %v are not the primary key or a unique index of %s",
+			conflictColumns, stmt.Schema.Name)
+	}
+
+	onConflict := clause.OnConflict{}
+
+	if len(updateColumns) > 0 {
+		onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+	} else {
+		onConflict.DoNothing = true
+	}
+
+	upsertChunks := func(ctx context.Context) error {
+		for _, chunk := range splitUpsertChunks(ctx, stmt.Schema, rowsValue, options.MaxRows, options.MaxBytes) {
+			chunkRows := reflect.New(chunk.Type())
+			chunkRows.Elem().Set(chunk)
+
+			retGorm := p.DB(ctx, options.RunMode).
+				Set(metricOperationKey, bulkUpsertOperation).
+				Clauses(onConflict).
+				Create(chunkRows.Interface())
+			if retGorm.Error != nil {
+				return fmt.Errorf("bulk upsert chunk %d: %w", result.Chunks+1, retGorm.Error)
+			}
+
+			result.add(int64(chunk.Len()), retGorm.RowsAffected)
+		}
+
+		return nil
+	}
+
+	if !options.InTransaction {
+		err := upsertChunks(ctx)
+		if err != nil {
+			return result, err
+		}
+
+		return result, nil
+	}
+
+	err = p.WithTxContext(ctx, options.RunMode, func(ctx context.Context) error {
+		*result = BulkUpsertResult{}
+
+		return upsertChunks(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isUniqueKey reports whether columns, in any order, are the primary key of rowSchema or the columns of one of its
+// unique indexes.
+func isUniqueKey(rowSchema *schema.Schema, columns []string) bool {
+	columns = slices.Sorted(slices.Values(columns))
+
+	matches := func(keyColumns []string) bool {
+		return slices.Equal(slices.Sorted(slices.Values(keyColumns)), columns)
+	}
+
+	if matches(rowSchema.PrimaryFieldDBNames) {
+		return true
+	}
+
+	for _, field := range rowSchema.Fields {
+		if field.Unique && matches([]string{field.DBName}) {
+			return true
+		}
+	}
+
+	for _, index := range rowSchema.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+
+		keyColumns := make([]string, 0, len(index.Fields))
+		for _, option := range index.Fields {
+			if option.Field != nil {
+				keyColumns = append(keyColumns, option.Field.DBName)
+			}
+		}
+
+		if matches(keyColumns) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitUpsertChunks partitions rowsValue into consecutive sub-slices bounded by maxRows rows and maxBytes
+// estimated bytes.
+func splitUpsertChunks(ctx context.Context, rowSchema *schema.Schema, rowsValue reflect.Value, maxRows, maxBytes int) []reflect.Value {
+	chunks := make([]reflect.Value, 0, rowsValue.Len()/maxRows+1)
+
+	start := 0
+	chunkBytes := 0
+
+	for i := 0; i < rowsValue.Len(); i++ {
+		rowBytes := estimateRowBytes(ctx, rowSchema, rowsValue.Index(i))
+
+		if i > start && (i-start >= maxRows || chunkBytes+rowBytes > maxBytes) {
+			chunks = append(chunks, rowsValue.Slice(start, i))
+
+			start = i
+			chunkBytes = 0
+		}
+
+		chunkBytes += rowBytes
+	}
+
+	return append(chunks, rowsValue.Slice(start, rowsValue.Len()))
+}
+
+// estimateRowBytes approximates the encoded size of one row's column values in an INSERT statement.
+func estimateRowBytes(ctx context.Context, rowSchema *schema.Schema, rowValue reflect.Value) int {
+	rowValue = reflect.Indirect(rowValue)
+
+	size := 0
+
+	for _, field := range rowSchema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		// Quotes, separators, and escaping overhead.
+		size += 4
+
+		value, isZero := field.ValueOf(ctx, rowValue)
+		if isZero {
+			size += 4
+
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += 2 * len(v)
+		case time.Time:
+			size += 26
+		default:
+			size += 20
+		}
+	}
+
+	return size
+}
+
+// metricOperation returns the operation label override set on the statement, if any.
+func metricOperation(db *gorm.DB) (string, bool) {
+	value, ok := db.Get(metricOperationKey)
+	if !ok {
+		return "", false
+	}
+
+	operation, ok := value.(string)
+
+	return operation, ok && operation != ""
+}
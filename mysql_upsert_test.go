@@ -0,0 +1,214 @@
+package tdb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type upsertTestRow struct {
+	Id    uint64
+	Sku   string `gorm:"uniqueIndex"`
+	Code  string `gorm:"unique"`
+	Shop  string `gorm:"uniqueIndex:idx_shop_slot"`
+	Slot  string `gorm:"uniqueIndex:idx_shop_slot"`
+	Note  string `gorm:"index"`
+	Price int64
+}
+
+func TestSplitUpsertChunks(t *testing.T) {
+	rowSchema := parseTestSchema(t, &upsertTestRow{})
+
+	small := upsertTestRow{Sku: "s"}
+	large := upsertTestRow{Sku: strings.Repeat("l", 1000)}
+
+	smallBytes := estimateRowBytes(context.Background(), rowSchema, reflect.ValueOf(small))
+	largeBytes := estimateRowBytes(context.Background(), rowSchema, reflect.ValueOf(large))
+
+	tests := []struct {
+		name     string
+		rows     []upsertTestRow
+		maxRows  int
+		maxBytes int
+		want     []int
+	}{
+		{
+			name:     "single chunk",
+			rows:     []upsertTestRow{small, small, small},
+			maxRows:  10,
+			maxBytes: 1 << 20,
+			want:     []int{3},
+		},
+		{
+			name:     "by rows",
+			rows:     []upsertTestRow{small, small, small, small, small},
+			maxRows:  2,
+			maxBytes: 1 << 20,
+			want:     []int{2, 2, 1},
+		},
+		{
+			name:     "by bytes",
+			rows:     []upsertTestRow{small, small, small, small, small},
+			maxRows:  10,
+			maxBytes: 2*smallBytes + 1,
+			want:     []int{2, 2, 1},
+		},
+		{
+			name:     "exactly at the byte limit",
+			rows:     []upsertTestRow{small, small, small},
+			maxRows:  10,
+			maxBytes: 3 * smallBytes,
+			want:     []int{3},
+		},
+		{
+			name:     "oversize row in the middle",
+			rows:     []upsertTestRow{small, large, small},
+			maxRows:  10,
+			maxBytes: largeBytes - 1,
+			want:     []int{1, 1, 1},
+		},
+		{
+			name:     "oversize row first",
+			rows:     []upsertTestRow{large, small, small},
+			maxRows:  10,
+			maxBytes: largeBytes - 1,
+			want:     []int{1, 2},
+		},
+		{
+			name:     "oversize rows only",
+			rows:     []upsertTestRow{large, large},
+			maxRows:  10,
+			maxBytes: smallBytes,
+			want:     []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitUpsertChunks(context.Background(), rowSchema, reflect.ValueOf(tt.rows), tt.maxRows, tt.maxBytes)
+
+			got := make([]int, 0, len(chunks))
+			total := 0
+
+			for _, chunk := range chunks {
+				got = append(got, chunk.Len())
+				total += chunk.Len()
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunk sizes = %v, want %v", got, tt.want)
+			}
+
+			if total != len(tt.rows) {
+				t.Errorf("chunks hold %d rows, want %d", total, len(tt.rows))
+			}
+		})
+	}
+}
+
+func TestEstimateRowBytes(t *testing.T) {
+	rowSchema := parseTestSchema(t, &upsertTestRow{})
+
+	empty := estimateRowBytes(context.Background(), rowSchema, reflect.ValueOf(upsertTestRow{}))
+	sized := estimateRowBytes(context.Background(), rowSchema, reflect.ValueOf(&upsertTestRow{Note: "0123456789"}))
+
+	if sized-empty != 10-4 {
+		t.Errorf("a 10 byte string adds %d bytes over a zero value, want %d", sized-empty, 10-4)
+	}
+}
+
+func TestBulkUpsertResultAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		rowCount int64
+		affected int64
+		want     BulkUpsertResult
+	}{
+		{
+			name:     "all inserted",
+			rowCount: 3,
+			affected: 3,
+			want:     BulkUpsertResult{Chunks: 1, Affected: 3, Inserted: 3},
+		},
+		{
+			name:     "all updated",
+			rowCount: 3,
+			affected: 6,
+			want:     BulkUpsertResult{Chunks: 1, Affected: 6, Updated: 3},
+		},
+		{
+			name:     "all unchanged",
+			rowCount: 3,
+			affected: 0,
+			want:     BulkUpsertResult{Chunks: 1, Unchanged: 3},
+		},
+		{
+			name:     "inserted and updated",
+			rowCount: 3,
+			affected: 5,
+			want:     BulkUpsertResult{Chunks: 1, Affected: 5, Inserted: 1, Updated: 2},
+		},
+		{
+			name:     "ambiguous counts favor inserts",
+			rowCount: 3,
+			affected: 2,
+			want:     BulkUpsertResult{Chunks: 1, Affected: 2, Inserted: 2, Unchanged: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := BulkUpsertResult{}
+			result.add(tt.rowCount, tt.affected)
+
+			if result != tt.want {
+				t.Errorf("add(%d, %d) = %+v, want %+v", tt.rowCount, tt.affected, result, tt.want)
+			}
+
+			if result.Inserted+result.Updated+result.Unchanged != tt.rowCount {
+				t.Errorf("add(%d, %d) accounts for %d rows", tt.rowCount, tt.affected,
+					result.Inserted+result.Updated+result.Unchanged)
+			}
+		})
+	}
+
+	result := BulkUpsertResult{}
+	result.add(3, 3)
+	result.add(2, 4)
+
+	want := BulkUpsertResult{Chunks: 2, Affected: 7, Inserted: 3, Updated: 2}
+	if result != want {
+		t.Errorf("accumulated result = %+v, want %+v", result, want)
+	}
+}
+
+func TestIsUniqueKey(t *testing.T) {
+	rowSchema := parseTestSchema(t, &upsertTestRow{})
+
+	tests := []struct {
+		columns []string
+		want    bool
+	}{
+		{columns: []string{"id"}, want: true},
+		{columns: []string{"sku"}, want: true},
+		{columns: []string{"code"}, want: true},
+		{columns: []string{"shop", "slot"}, want: true},
+		{columns: []string{"slot", "shop"}, want: true},
+		{columns: []string{"shop"}, want: false},
+		{columns: []string{"shop", "shop"}, want: false},
+		{columns: []string{"note"}, want: false},
+		{columns: []string{"price"}, want: false},
+		{columns: []string{"id", "sku"}, want: false},
+		{columns: []string{"missing"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.columns, ","), func(t *testing.T) {
+			got := isUniqueKey(rowSchema, tt.columns)
+			if got != tt.want {
+				t.Errorf("isUniqueKey(%v) = %v, want %v", tt.columns, got, tt.want)
+			}
+		})
+	}
+}
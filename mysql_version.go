@@ -0,0 +1,245 @@
+package tdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	versionPluginName = "tdb:optimistic_lock"
+
+	versionExpectedKey = "tdb:version_expected"
+)
+
+// ErrStaleVersion is returned by updates of a model with a [Version] field when the row was modified or deleted
+// since the model was loaded.
+var ErrStaleVersion = errors.New("stale row version")
+
+// Version is an optimistic-locking counter. Declare it as a model field backed by a NOT NULL integer column:
+//
+//	type Order struct {
+//		ID      int64
+//		Status  string
+//		Version tdb.Version
+//	}
+//
+// Creating a model stores version 1 unless it is already set. Updating or saving a loaded model adds
+// WHERE version = ? with the loaded value, writes the incremented value, and fails with [ErrStaleVersion]
+// when no row matched. Updates without a loaded model, such as bulk updates by condition, increment the column
+// without checking it when the update values are a map.
+type Version int64
+
+// versionPlugin implements optimistic locking for [Version] fields. openDB installs it on every client.
+type versionPlugin struct {
+	fields sync.Map
+}
+
+// Name implements [gorm.Plugin].
+func (p *versionPlugin) Name() string {
+	return versionPluginName
+}
+
+// Initialize implements [gorm.Plugin].
+func (p *versionPlugin) Initialize(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Create().Before("gorm:create").Register("tdb:version_before_create", p.beforeCreate),
+		db.Callback().Update().Before("gorm:update").Register("tdb:version_before_update", p.beforeUpdate),
+		db.Callback().Update().After("gorm:update").Register("tdb:version_after_update", p.afterUpdate),
+	)
+}
+
+// versionField returns the [Version] field of the statement's model, if any.
+func (p *versionPlugin) versionField(stmt *gorm.Statement) *schema.Field {
+	if stmt.Schema == nil {
+		return nil
+	}
+
+	if field, ok := p.fields.Load(stmt.Schema); ok {
+		return field.(*schema.Field)
+	}
+
+	var versionField *schema.Field
+
+	versionType := reflect.TypeOf(Version(0))
+
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName != "" && field.FieldType == versionType {
+			versionField = field
+
+			break
+		}
+	}
+
+	p.fields.Store(stmt.Schema, versionField)
+
+	return versionField
+}
+
+// beforeCreate initializes zero versions to 1, so that every loaded row carries a version to check.
+func (p *versionPlugin) beforeCreate(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	field := p.versionField(db.Statement)
+	if field == nil {
+		return
+	}
+
+	initVersion := func(rowValue reflect.Value) {
+		rowValue = reflect.Indirect(rowValue)
+		if rowValue.Kind() != reflect.Struct || !rowValue.CanAddr() {
+			return
+		}
+
+		if _, isZero := field.ValueOf(db.Statement.Context, rowValue); isZero {
+			_ = db.AddError(field.Set(db.Statement.Context, rowValue, Version(1)))
+		}
+	}
+
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			initVersion(db.Statement.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		initVersion(db.Statement.ReflectValue)
+	}
+}
+
+// beforeUpdate adds the version check and increment. A loaded model, one with a non-zero primary key and version,
+// is checked against its version; other updates only increment the column.
+func (p *versionPlugin) beforeUpdate(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	stmt := db.Statement
+
+	field := p.versionField(stmt)
+	if field == nil {
+		return
+	}
+
+	current, ok := loadedVersion(stmt.Context, stmt, field)
+	if !ok {
+		if dest, isMap := stmt.Dest.(map[string]any); isMap {
+			dest[field.DBName] = gorm.Expr("? + 1", clause.Column{Name: field.DBName})
+		}
+
+		return
+	}
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Name: field.DBName}, Value: current},
+	}})
+
+	if len(stmt.Selects) > 0 && !slices.Contains(stmt.Selects, "*") && !slices.Contains(stmt.Selects, field.DBName) {
+		stmt.Selects = append(stmt.Selects, field.DBName)
+	}
+
+	stmt.SetColumn(field.DBName, current+1, true)
+
+	db.Set(versionExpectedKey, current)
+}
+
+// afterUpdate reports [ErrStaleVersion] when a checked update matched no row and keeps the in-memory version of
+// the model in step with the database.
+func (p *versionPlugin) afterUpdate(db *gorm.DB) {
+	value, ok := db.Get(versionExpectedKey)
+	if !ok {
+		return
+	}
+
+	db.Statement.Settings.Delete(versionExpectedKey)
+
+	current, ok := value.(Version)
+	if !ok {
+		return
+	}
+
+	stmt := db.Statement
+
+	field := p.versionField(stmt)
+	if field == nil || !stmt.ReflectValue.CanAddr() {
+		return
+	}
+
+	if db.Error == nil && db.RowsAffected == 0 {
+		_ = db.AddError(fmt.Errorf("%w: table %s version %d", ErrStaleVersion, stmt.Table, current))
+	}
+
+	if db.Error != nil {
+		_ = field.Set(stmt.Context, stmt.ReflectValue, current)
+
+		return
+	}
+
+	_ = db.AddError(field.Set(stmt.Context, stmt.ReflectValue, current+1))
+}
+
+// loadedVersion returns the version of the statement's model when it is a single addressable row with a non-zero
+// primary key and version.
+func loadedVersion(ctx context.Context, stmt *gorm.Statement, field *schema.Field) (Version, bool) {
+	if stmt.ReflectValue.Kind() != reflect.Struct || !stmt.ReflectValue.CanAddr() ||
+		len(stmt.Schema.PrimaryFields) == 0 {
+		return 0, false
+	}
+
+	for _, primaryField := range stmt.Schema.PrimaryFields {
+		if _, isZero := primaryField.ValueOf(ctx, stmt.ReflectValue); isZero {
+			return 0, false
+		}
+	}
+
+	value, isZero := field.ValueOf(ctx, stmt.ReflectValue)
+	if isZero {
+		return 0, false
+	}
+
+	current, ok := value.(Version)
+
+	return current, ok
+}
+
+// Modify loads the row whose primary key equals id from the primary, applies mutate, and saves it with an
+// optimistic version check. When another writer got there first, the row is reloaded and mutate runs again,
+// up to maxAttempts times in total, before [ErrStaleVersion] is returned. T must have a [Version] field, and mutate
+// must not have side effects outside the record, since it may run more than once.
+func (p *Repo[T]) Modify(ctx context.Context, id any, maxAttempts int, mutate func(record *T) error,
+	conds ...any) (*T, error) {
+	var err error
+
+	for attempt := 0; attempt < max(maxAttempts, 1); attempt++ {
+		var record *T
+
+		record, err = p.Get(WithPrimary(ctx), id, conds...)
+		if err != nil {
+			return nil, err
+		}
+
+		err = mutate(record)
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.client.DB(ctx, p.runMode).Save(record).Error
+		if err == nil {
+			return record, nil
+		}
+
+		if !errors.Is(err, ErrStaleVersion) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
@@ -53,6 +53,24 @@ func MonthlyShardingByTime(shardingKey string, tables []string) *sharding.Shardi
 	}, tables)
 }
 
+// MonthlyShardTableByOid returns the physical monthly shard of table that holds the row identified by the MongoDB ObjectID hex string oid.
+// It is useful for queries, such as keyset pagination, whose conditions cannot be routed by the sharding middleware.
+func MonthlyShardTableByOid(table string, oid string) (string, error) {
+	suffix, err := monthlyShardingAlgorithmByOid(oid)
+	if err != nil {
+		return "", err
+	}
+
+	return table + suffix, nil
+}
+
+// MonthlyShardTableByTime returns the physical monthly shard of table that holds rows whose sharding key falls in the UTC month of t.
+func MonthlyShardTableByTime(table string, t time.Time) string {
+	suffix, _ := monthlyShardingAlgorithmByTime(t)
+
+	return table + suffix
+}
+
 // listTables returns all table names in the current database in lexicographic order.
 func (p *MysqlClient) listTables(ctx context.Context) ([]string, error) {
 	tables := make([]string, 0)